@@ -0,0 +1,37 @@
+// Package lrtest holds test helpers shared by the left-right data structures.
+package lrtest
+
+import "sync"
+
+// Readers is the number of reader go routines started by ConcurrentReaders.
+const Readers = 4
+
+// ConcurrentReaders calls write with i going from 0 to n-1, while Readers go routines keep calling read in a loop.
+// Each reader passes its own index in [0, Readers) to read, so it can keep per-reader state. Returns once all the
+// writes are done and all the readers have stopped.
+//
+// read should check an invariant that the writer only ever breaks in between two Publish calls, so a reader that sees a
+// half-applied batch fails the test.
+func ConcurrentReaders(n int, read func(reader int), write func(i int)) {
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for r := 0; r < Readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				read(r)
+			}
+		}(r)
+	}
+	for i := 0; i < n; i++ {
+		write(i)
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,171 @@
+package deque
+
+import (
+	"errors"
+)
+
+// ErrFull is returned when pushing to a full BoundedDeque with the Reject policy.
+var ErrFull = errors.New("deque is full")
+
+// OverflowPolicy decides what a BoundedDeque does when an element is pushed while it is full.
+type OverflowPolicy int
+
+const (
+	// Reject leaves the deque unchanged and returns ErrFull.
+	Reject OverflowPolicy = iota
+	// DropOldest makes room by removing an element from the opposite end of the one being pushed to, which is the
+	// oldest one when the deque is used as a queue. Insert removes the element at the front.
+	DropOldest
+	// DropNewest discards the element being pushed.
+	DropNewest
+	// Grow lets the deque grow past its maximum length, which becomes advisory and can be checked with Full.
+	Grow
+)
+
+// BoundedDeque is a Deque holding at most a given number of elements. It embeds Deque, so all the methods that don't
+// add elements work the same, while PushBack, PushFront, PushBackN and Insert apply the overflow policy.
+type BoundedDeque[T any] struct {
+	Deque[T]
+	// maxLen is the maximum number of elements, or zero for no limit.
+	maxLen int
+	policy OverflowPolicy
+	// dropped counts the elements discarded by DropOldest and DropNewest.
+	dropped int
+}
+
+// NewBoundedDeque creates a new BoundedDeque holding at most maxLen elements and applying the given policy when it is
+// full. A non-positive maxLen means no limit.
+func NewBoundedDeque[T any](maxLen int, policy OverflowPolicy) BoundedDeque[T] {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	capacity := 16
+	if maxLen > 0 && maxLen < capacity {
+		capacity = maxLen
+	}
+	return BoundedDeque[T]{
+		Deque:  NewDequeWithCapacity[T](capacity),
+		maxLen: maxLen,
+		policy: policy,
+	}
+}
+
+// MaxLen returns the maximum number of elements, or zero if there is no limit.
+func (q *BoundedDeque[T]) MaxLen() int {
+	return q.maxLen
+}
+
+// Policy returns the overflow policy.
+func (q *BoundedDeque[T]) Policy() OverflowPolicy {
+	return q.policy
+}
+
+// Full returns true if the deque holds at least MaxLen elements.
+func (q *BoundedDeque[T]) Full() bool {
+	return q.maxLen > 0 && q.count >= q.maxLen
+}
+
+// Dropped returns the number of elements discarded so far by the DropOldest and DropNewest policies.
+func (q *BoundedDeque[T]) Dropped() int {
+	return q.dropped
+}
+
+// PushBack inserts a new element at the end, applying the overflow policy if the deque is full. Returns ErrFull if the
+// element was rejected.
+func (q *BoundedDeque[T]) PushBack(v T) error {
+	if q.Full() {
+		switch q.policy {
+		case Reject:
+			return ErrFull
+		case DropOldest:
+			q.TryPopFront()
+			q.dropped++
+		case DropNewest:
+			q.dropped++
+			return nil
+		}
+	}
+	q.Deque.PushBack(v)
+	return nil
+}
+
+// PushFront inserts a new element at the start, applying the overflow policy if the deque is full. Returns ErrFull if
+// the element was rejected.
+func (q *BoundedDeque[T]) PushFront(v T) error {
+	if q.Full() {
+		switch q.policy {
+		case Reject:
+			return ErrFull
+		case DropOldest:
+			q.TryPopBack()
+			q.dropped++
+		case DropNewest:
+			q.dropped++
+			return nil
+		}
+	}
+	q.Deque.PushFront(v)
+	return nil
+}
+
+// PushBackN inserts all the given elements at the end, in order, applying the overflow policy to those that don't fit.
+// With Reject, either all elements are pushed or none are and ErrFull is returned.
+func (q *BoundedDeque[T]) PushBackN(vs []T) error {
+	room := len(vs)
+	if q.maxLen > 0 && q.policy != Grow {
+		room = q.maxLen - q.count
+		if room < 0 {
+			room = 0
+		}
+	}
+	if room >= len(vs) {
+		q.Deque.PushBackN(vs)
+		return nil
+	}
+	switch q.policy {
+	case Reject:
+		return ErrFull
+	case DropOldest:
+		if len(vs) >= q.maxLen {
+			// Everything already in the deque gets dropped, along with the first of the new elements.
+			q.dropped += q.count + len(vs) - q.maxLen
+			q.Clear()
+			q.Deque.PushBackN(vs[len(vs)-q.maxLen:])
+			return nil
+		}
+		for i := room; i < len(vs); i++ {
+			q.TryPopFront()
+			q.dropped++
+		}
+		q.Deque.PushBackN(vs)
+	case DropNewest:
+		q.dropped += len(vs) - room
+		q.Deque.PushBackN(vs[:room])
+	}
+	return nil
+}
+
+// Insert inserts a new element at position i, counting from the front, applying the overflow policy if the deque is
+// full. DropOldest removes the element at the front after inserting, which is the new one if i is zero. Returns ErrFull
+// if the element was rejected. Panics if i is not in [0, Len()].
+func (q *BoundedDeque[T]) Insert(i int, v T) error {
+	if i < 0 || i > q.count {
+		panic("deque: index out of range")
+	}
+	if q.Full() {
+		switch q.policy {
+		case Reject:
+			return ErrFull
+		case DropOldest:
+			q.Deque.Insert(i, v)
+			q.TryPopFront()
+			q.dropped++
+			return nil
+		case DropNewest:
+			q.dropped++
+			return nil
+		}
+	}
+	q.Deque.Insert(i, v)
+	return nil
+}
@@ -0,0 +1,84 @@
+package deque
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedReject(t *testing.T) {
+	q := NewBoundedDeque[int](3, Reject)
+	assert.Equal(t, 3, q.MaxLen())
+	assert.Equal(t, Reject, q.Policy())
+	assert.Nil(t, q.PushBack(1))
+	assert.Nil(t, q.PushFront(0))
+	assert.Nil(t, q.PushBack(2))
+	assert.True(t, q.Full())
+	assert.ErrorIs(t, q.PushBack(3), ErrFull)
+	assert.ErrorIs(t, q.PushFront(3), ErrFull)
+	assert.ErrorIs(t, q.Insert(1, 3), ErrFull)
+	assert.Equal(t, []int{0, 1, 2}, q.ToSlice())
+
+	q.PopFront()
+	assert.ErrorIs(t, q.PushBackN([]int{3, 4}), ErrFull)
+	assert.Nil(t, q.PushBackN([]int{3}))
+	assert.Equal(t, []int{1, 2, 3}, q.ToSlice())
+	assert.Equal(t, 0, q.Dropped())
+}
+
+func TestBoundedDropOldest(t *testing.T) {
+	q := NewBoundedDeque[int](3, DropOldest)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, q.PushBack(i))
+	}
+	assert.Equal(t, []int{2, 3, 4}, q.ToSlice())
+	assert.Nil(t, q.PushFront(1))
+	assert.Equal(t, []int{1, 2, 3}, q.ToSlice())
+	assert.Nil(t, q.Insert(2, 9))
+	assert.Equal(t, []int{2, 9, 3}, q.ToSlice())
+	assert.Nil(t, q.Insert(0, 8))
+	assert.Equal(t, []int{2, 9, 3}, q.ToSlice())
+	assert.Equal(t, 5, q.Dropped())
+
+	assert.Nil(t, q.PushBackN([]int{4, 5}))
+	assert.Equal(t, []int{3, 4, 5}, q.ToSlice())
+	assert.Nil(t, q.PushBackN([]int{6, 7, 8, 9}))
+	assert.Equal(t, []int{7, 8, 9}, q.ToSlice())
+	assert.Equal(t, 11, q.Dropped())
+	assert.Equal(t, 4, q.Cap())
+}
+
+func TestBoundedDropNewest(t *testing.T) {
+	q := NewBoundedDeque[int](3, DropNewest)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, q.PushBack(i))
+	}
+	assert.Nil(t, q.PushFront(9))
+	assert.Nil(t, q.Insert(1, 9))
+	assert.Equal(t, []int{0, 1, 2}, q.ToSlice())
+	q.PopBack()
+	assert.Nil(t, q.PushBackN([]int{3, 4, 5}))
+	assert.Equal(t, []int{0, 1, 3}, q.ToSlice())
+	assert.Equal(t, 6, q.Dropped())
+}
+
+func TestBoundedGrow(t *testing.T) {
+	q := NewBoundedDeque[int](2, Grow)
+	assert.False(t, q.Full())
+	assert.Nil(t, q.PushBack(1))
+	assert.Nil(t, q.PushBack(2))
+	assert.True(t, q.Full())
+	assert.Nil(t, q.PushFront(0))
+	assert.Nil(t, q.PushBackN([]int{3, 4}))
+	assert.Nil(t, q.Insert(5, 5))
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, q.ToSlice())
+	assert.Equal(t, 0, q.Dropped())
+
+	// Without a limit, the deque is never full.
+	u := NewBoundedDeque[int](0, Reject)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, u.PushBack(i))
+	}
+	assert.False(t, u.Full())
+	assert.Equal(t, 100, u.Len())
+}
@@ -2,124 +2,467 @@ package deque
 
 import (
 	"errors"
+	"math/bits"
 )
 
+// ErrEmpty is returned when reading from an empty deque.
+var ErrEmpty = errors.New("deque is empty")
+
 // Operation is the generic input accepted by the left-right data structure. Defined as an alias for readability.
-type Operation interface{}
+type Operation = any
+
+// OpDeque is a deque of operations, for callers that predate the generic Deque. Go doesn't allow the generic Deque to
+// keep its old non-generic name, so those callers only have to switch to OpDeque and NewOpDeque.
+type OpDeque = Deque[Operation]
 
-// Deque is a generic double ended queue implemented with a ring buffer.
-type Deque struct {
-	// data is the underlying data storage. Starts at a given capacity and is doubled whenever we fill it.
-	data []Operation
-	// head is the index of the first valid element in data, if any.
+// Deque is a generic double ended queue implemented with a ring buffer. Elements are stored unboxed, so pushing values
+// like ints or small structs doesn't allocate.
+type Deque[T any] struct {
+	// data is the underlying data storage. Its length is always a power of two (or zero), so positions can be wrapped
+	// around with a mask instead of a division. It is doubled whenever we fill it and halved whenever it falls below a
+	// quarter full.
+	data []T
+	// head is the index of the first valid element in data, if any. The element at position i is stored at index
+	// (head + i) & mask.
 	head int
-	// tail is the index of the last valid element in data, if any.
-	tail int
 	// count keeps track of the number of elements we're storing in data.
 	count int
+	// minCap is the initial capacity, below which data is never shrunk automatically.
+	minCap int
+}
+
+// roundUp returns the smallest power of two that is at least n, or zero if n is not positive.
+func roundUp(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return 1 << bits.Len(uint(n-1))
 }
 
-// NewDequeWithCapacity creates a new deque with an initial capacity of `cap`.
-func NewDequeWithCapacity(cap int) Deque {
-	return Deque{
-		data:  make([]Operation, cap),
-		head:  0,
-		tail:  0,
-		count: 0,
+// NewDequeWithCapacity creates a new deque with an initial capacity of `cap`, rounded up to a power of two.
+func NewDequeWithCapacity[T any](cap int) Deque[T] {
+	cap = roundUp(cap)
+	return Deque[T]{
+		data:   make([]T, cap),
+		head:   0,
+		count:  0,
+		minCap: cap,
 	}
 }
 
 // NewDeque creates a new Deque with initial capacity 16.
 // Why 16? https://youtu.be/0obMRztklqU
-func NewDeque() Deque {
-	return NewDequeWithCapacity(16)
+func NewDeque[T any]() Deque[T] {
+	return NewDequeWithCapacity[T](16)
+}
+
+// NewOpDeque creates a new OpDeque with initial capacity 16. It replaces the non-generic NewDeque.
+func NewOpDeque() OpDeque {
+	return NewDeque[Operation]()
+}
+
+// NewOpDequeWithCapacity creates a new OpDeque with an initial capacity of `cap`, rounded up to a power of two. It
+// replaces the non-generic NewDequeWithCapacity.
+func NewOpDequeWithCapacity(cap int) OpDeque {
+	return NewDequeWithCapacity[Operation](cap)
 }
 
 // Len returns the number of elements in the deque.
-func (q *Deque) Len() int {
+func (q *Deque[T]) Len() int {
 	return q.count
 }
 
-// checkCapacity doubles the capacity of deque if it ran out of space.
-func (q *Deque) checkCapacity() {
-	if q.count < len(q.data) {
-		return
+// Cap returns the number of elements the deque can hold before it has to grow.
+func (q *Deque[T]) Cap() int {
+	return len(q.data)
+}
+
+// mask wraps indices around the end of data. Only valid when data is not empty.
+func (q *Deque[T]) mask() int {
+	return len(q.data) - 1
+}
+
+// tail returns the index of the last valid element in data. Only valid when the deque is not empty.
+func (q *Deque[T]) tail() int {
+	return q.wrap(q.count - 1)
+}
+
+// Reserve grows the deque, if needed, so that at least n more elements can be pushed without reallocating. Popping
+// elements may shrink it again.
+func (q *Deque[T]) Reserve(n int) {
+	if q.count+n > len(q.data) {
+		q.resize(roundUp(q.count + n))
 	}
+}
 
-	if len(q.data) == 0 {
-		q.data = make([]Operation, 1)
-		return
+// ShrinkToFit reduces the capacity of the deque to the smallest power of two that fits its elements, releasing the
+// rest of the memory.
+func (q *Deque[T]) ShrinkToFit() {
+	if c := roundUp(q.count); c < len(q.data) {
+		q.resize(c)
 	}
+}
+
+// resize moves the elements into a new buffer of the given capacity, which must be a power of two that fits all of
+// them, starting at index 0. This linearises the ring with a single copy (two when it wraps around).
+func (q *Deque[T]) resize(capacity int) {
+	data := make([]T, capacity)
+	q.CopyTo(data)
+	q.data = data
+	q.head = 0
+}
 
-	if q.head == 0 {
-		// If head is at zero, we don't have to do any work, just append empty slots.
-		q.data = append(q.data, make([]Operation, q.count)...)
+// checkShrink halves the capacity of deque once it falls below a quarter full. Halving at a quarter rather than at a
+// half leaves the deque half full, so alternating pushes and pops around the threshold don't keep reallocating.
+func (q *Deque[T]) checkShrink() {
+	if q.count >= len(q.data)/4 || len(q.data)/2 < q.minCap {
 		return
 	}
-	// Since we're using a ring buffer we have to move elements around to ensure a sequential buffer.
-	// Because data is full we know that it looks something like: 6 7 T H 2 3 4 5
-	// but we want to change it to: . . . H 2 3 4 5 6 7 T . . . . .
-	// We do this by duplicating it and then setting unneeded elements to nil to prevent memory leaks.
-	q.data = append(q.data, q.data...)
-	q.tail += q.count
-	for i := 0; i < q.head; i++ {
-		q.data[i] = nil
+	q.resize(len(q.data) / 2)
+}
+
+// checkCapacity doubles the capacity of deque if it ran out of space.
+func (q *Deque[T]) checkCapacity() {
+	if q.count < len(q.data) {
+		return
 	}
-	for i := q.tail + 1; i < len(q.data); i++ {
-		q.data[i] = nil
+	if len(q.data) == 0 {
+		q.data = make([]T, 1)
+		q.head = 0
+		return
 	}
+	q.resize(2 * len(q.data))
 }
 
 // PushBack inserts a new element at the end.
-func (q *Deque) PushBack(op Operation) {
+func (q *Deque[T]) PushBack(v T) {
 	q.checkCapacity()
-	if q.count == 0 {
-		q.head = 0
-		q.tail = 0
-	} else {
-		q.tail += 1
-		q.tail %= len(q.data)
-	}
-	q.data[q.tail] = op
+	q.data[q.wrap(q.count)] = v
 	q.count += 1
 }
 
 // PushFront inserts a new element at the start.
-func (q *Deque) PushFront(op Operation) {
+func (q *Deque[T]) PushFront(v T) {
 	q.checkCapacity()
-	if q.count == 0 {
-		q.head = 0
-		q.tail = 0
-	} else {
-		q.head += len(q.data) - 1
-		q.head %= len(q.data)
-	}
-	q.data[q.head] = op
+	q.head = (q.head - 1) & q.mask()
+	q.data[q.head] = v
 	q.count += 1
 }
 
-// PopBack removes and returns the last element in deque or returns an error if deque is empty.
-func (q *Deque) PopBack() (Operation, error) {
+// PopBack removes and returns the last element in deque or returns ErrEmpty if deque is empty.
+func (q *Deque[T]) PopBack() (T, error) {
+	v, ok := q.TryPopBack()
+	if !ok {
+		return v, ErrEmpty
+	}
+	return v, nil
+}
+
+// PopFront removes and returns the first element in deque or returns ErrEmpty if deque is empty.
+func (q *Deque[T]) PopFront() (T, error) {
+	v, ok := q.TryPopFront()
+	if !ok {
+		return v, ErrEmpty
+	}
+	return v, nil
+}
+
+// TryPopBack removes and returns the last element in deque. Returns the zero value and false if deque is empty.
+func (q *Deque[T]) TryPopBack() (T, bool) {
+	var zero T
 	if q.count == 0 {
-		return nil, errors.New("cannot PopBack because deque is empty")
+		return zero, false
 	}
-	val := q.data[q.tail]
-	q.data[q.tail] = nil
+	tail := q.tail()
+	val := q.data[tail]
+	q.data[tail] = zero
 	q.count -= 1
-	q.tail += len(q.data) - 1
-	q.tail %= len(q.data)
-	return val, nil
+	q.checkShrink()
+	return val, true
 }
 
-// PopFront removes and returns the first element in deque or returns an error if deque is empty.
-func (q *Deque) PopFront() (Operation, error) {
+// TryPopFront removes and returns the first element in deque. Returns the zero value and false if deque is empty.
+func (q *Deque[T]) TryPopFront() (T, bool) {
+	var zero T
 	if q.count == 0 {
-		return nil, errors.New("cannot PopFront because deque is empty")
+		return zero, false
 	}
 	val := q.data[q.head]
-	q.data[q.head] = nil
+	q.data[q.head] = zero
 	q.count -= 1
-	q.head += 1
-	q.head %= len(q.data)
-	return val, nil
+	q.head = (q.head + 1) & q.mask()
+	q.checkShrink()
+	return val, true
+}
+
+// MustPopBack removes and returns the last element in deque. Panics with ErrEmpty if deque is empty.
+func (q *Deque[T]) MustPopBack() T {
+	v, ok := q.TryPopBack()
+	if !ok {
+		panic(ErrEmpty)
+	}
+	return v
+}
+
+// MustPopFront removes and returns the first element in deque. Panics with ErrEmpty if deque is empty.
+func (q *Deque[T]) MustPopFront() T {
+	v, ok := q.TryPopFront()
+	if !ok {
+		panic(ErrEmpty)
+	}
+	return v
+}
+
+// Front returns the first element without removing it or returns ErrEmpty if deque is empty.
+func (q *Deque[T]) Front() (T, error) {
+	if q.count == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return q.data[q.head], nil
+}
+
+// Back returns the last element without removing it or returns ErrEmpty if deque is empty.
+func (q *Deque[T]) Back() (T, error) {
+	if q.count == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return q.data[q.tail()], nil
+}
+
+// wrap converts the position of an element, counting from the front, to its index in data, without any range checks.
+func (q *Deque[T]) wrap(i int) int {
+	return (q.head + i) & q.mask()
+}
+
+// index converts the position of an element, counting from the front, to its index in data. Panics if i is out of
+// range, just like indexing a slice would.
+func (q *Deque[T]) index(i int) int {
+	if i < 0 || i >= q.count {
+		panic("deque: index out of range")
+	}
+	return q.wrap(i)
+}
+
+// At returns the i-th element, counting from the front. Panics if i is out of range.
+func (q *Deque[T]) At(i int) T {
+	return q.data[q.index(i)]
+}
+
+// Set replaces the i-th element, counting from the front. Panics if i is out of range.
+func (q *Deque[T]) Set(i int, v T) {
+	q.data[q.index(i)] = v
+}
+
+// Iter calls fn for every element from front to back, along with its position, until fn returns false. The deque must
+// not be modified while iterating.
+func (q *Deque[T]) Iter(fn func(i int, v T) bool) {
+	for i := 0; i < q.count; i++ {
+		if !fn(i, q.data[q.wrap(i)]) {
+			return
+		}
+	}
+}
+
+// IterBack calls fn for every element from back to front, along with its position, until fn returns false. The deque
+// must not be modified while iterating.
+func (q *Deque[T]) IterBack(fn func(i int, v T) bool) {
+	for i := q.count - 1; i >= 0; i-- {
+		if !fn(i, q.data[q.wrap(i)]) {
+			return
+		}
+	}
+}
+
+// Clear removes all elements, but keeps the underlying buffer so it can be reused.
+func (q *Deque[T]) Clear() {
+	var zero T
+	for i := 0; i < q.count; i++ {
+		q.data[q.wrap(i)] = zero
+	}
+	q.head = 0
+	q.count = 0
+}
+
+// Insert inserts a new element at position i, counting from the front, shifting the elements before or after it,
+// whichever are fewer. Panics if i is not in [0, Len()].
+func (q *Deque[T]) Insert(i int, v T) {
+	if i < 0 || i > q.count {
+		panic("deque: index out of range")
+	}
+	q.checkCapacity()
+	if i < q.count/2 {
+		// Move the elements before i one slot towards the front.
+		q.head = (q.head - 1) & q.mask()
+		for j := 0; j < i; j++ {
+			q.data[q.wrap(j)] = q.data[q.wrap(j+1)]
+		}
+	} else {
+		// Move the elements from i on one slot towards the back.
+		for j := q.count; j > i; j-- {
+			q.data[q.wrap(j)] = q.data[q.wrap(j-1)]
+		}
+	}
+	q.data[q.wrap(i)] = v
+	q.count += 1
+}
+
+// Remove removes and returns the element at position i, counting from the front, shifting the elements before or after
+// it, whichever are fewer. Panics if i is out of range.
+func (q *Deque[T]) Remove(i int) T {
+	val := q.data[q.index(i)]
+	var zero T
+	if i < q.count/2 {
+		// Move the elements before i one slot towards the back.
+		for j := i; j > 0; j-- {
+			q.data[q.wrap(j)] = q.data[q.wrap(j-1)]
+		}
+		q.data[q.head] = zero
+		q.head = (q.head + 1) & q.mask()
+	} else {
+		// Move the elements after i one slot towards the front.
+		for j := i; j < q.count-1; j++ {
+			q.data[q.wrap(j)] = q.data[q.wrap(j+1)]
+		}
+		q.data[q.wrap(q.count-1)] = zero
+	}
+	q.count -= 1
+	q.checkShrink()
+	return val
+}
+
+// Rotate moves the last n elements to the front, keeping their order. A negative n moves the first -n elements to the
+// back instead. Either way it moves at most half of the elements, or none if the deque is full.
+func (q *Deque[T]) Rotate(n int) {
+	if q.count <= 1 {
+		return
+	}
+	n %= q.count
+	if n < 0 {
+		n += q.count
+	}
+	if n == 0 {
+		return
+	}
+	if q.count == len(q.data) {
+		// The ring has no gaps, so we only need to move the head.
+		q.head = (q.head - n) & q.mask()
+		return
+	}
+	var zero T
+	if n <= q.count/2 {
+		for ; n > 0; n-- {
+			tail := q.tail()
+			q.head = (q.head - 1) & q.mask()
+			q.data[q.head] = q.data[tail]
+			q.data[tail] = zero
+		}
+		return
+	}
+	for n = q.count - n; n > 0; n-- {
+		q.data[q.wrap(q.count)] = q.data[q.head]
+		q.data[q.head] = zero
+		q.head = (q.head + 1) & q.mask()
+	}
+}
+
+// Swap exchanges the elements at positions i and j, counting from the front. Panics if either is out of range.
+func (q *Deque[T]) Swap(i, j int) {
+	i, j = q.index(i), q.index(j)
+	q.data[i], q.data[j] = q.data[j], q.data[i]
+}
+
+// Reverse reverses the order of the elements in place.
+func (q *Deque[T]) Reverse() {
+	for i, j := 0, q.count-1; i < j; i, j = i+1, j-1 {
+		a, b := q.wrap(i), q.wrap(j)
+		q.data[a], q.data[b] = q.data[b], q.data[a]
+	}
+}
+
+// PushBackN inserts all the given elements at the end, in order, growing the deque at most once.
+func (q *Deque[T]) PushBackN(vs []T) {
+	if len(vs) == 0 {
+		return
+	}
+	q.Reserve(len(vs))
+	// The free space may wrap around the end of the buffer, in which case we fill it in two parts.
+	n := copy(q.data[q.wrap(q.count):], vs)
+	copy(q.data, vs[n:])
+	q.count += len(vs)
+}
+
+// PopFrontN removes and returns up to n elements from the front, in order. Returns nil if the deque is empty.
+func (q *Deque[T]) PopFrontN(n int) []T {
+	if n > q.count {
+		n = q.count
+	}
+	if n <= 0 {
+		return nil
+	}
+	res := make([]T, n)
+	q.CopyTo(res)
+	// Zero the vacated slots, which may also wrap around the end of the buffer, to prevent memory leaks.
+	var zero T
+	first := q.data[q.head:]
+	if len(first) > n {
+		first = first[:n]
+	}
+	for i := range first {
+		first[i] = zero
+	}
+	for i := range q.data[:n-len(first)] {
+		q.data[i] = zero
+	}
+	q.head = q.wrap(n)
+	q.count -= n
+	q.checkShrink()
+	return res
+}
+
+// DrainTo removes all elements from the front and passes them to fn, in order. fn must not modify the deque. Once
+// drained, the deque keeps enough capacity for twice the number of drained elements, so it can be refilled to a
+// similar size without growing, but doesn't hold on to the memory of an earlier burst.
+func (q *Deque[T]) DrainTo(fn func(T)) {
+	capacity := roundUp(2 * q.count)
+	if capacity < q.minCap {
+		capacity = q.minCap
+	}
+	var zero T
+	for q.count > 0 {
+		// Remove each element before calling fn, so the deque stays consistent even if fn panics.
+		v := q.data[q.head]
+		q.data[q.head] = zero
+		q.head = q.wrap(1)
+		q.count -= 1
+		fn(v)
+	}
+	q.head = 0
+	if capacity < len(q.data) {
+		q.data = make([]T, capacity)
+	}
+}
+
+// CopyTo copies elements from the front into dst, in order, without removing them. Returns the number of elements
+// copied, which is the minimum of Len() and len(dst).
+func (q *Deque[T]) CopyTo(dst []T) int {
+	n := q.count
+	if n > len(dst) {
+		n = len(dst)
+	}
+	if n == 0 {
+		return 0
+	}
+	// The elements may wrap around the end of the buffer: 6 7 T . H 2 3 4 5 is copied as H 2 3 4 5 followed by 6 7 T.
+	first := copy(dst[:n], q.data[q.head:])
+	copy(dst[first:n], q.data[:n-first])
+	return n
+}
+
+// ToSlice returns a copy of all elements, from front to back.
+func (q *Deque[T]) ToSlice() []T {
+	res := make([]T, q.count)
+	q.CopyTo(res)
+	return res
 }
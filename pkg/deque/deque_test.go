@@ -2,11 +2,12 @@ package deque
 
 import (
 	"github.com/stretchr/testify/assert"
+	"math/rand"
 	"testing"
 )
 
 func TestFrontQueue(t *testing.T) {
-	q := NewDeque()
+	q := NewDeque[int]()
 	q.PushBack(1)
 	q.PushBack(2)
 	q.PushBack(3)
@@ -33,7 +34,7 @@ func TestFrontQueue(t *testing.T) {
 }
 
 func TestBackQueue(t *testing.T) {
-	q := NewDeque()
+	q := NewDeque[int]()
 	q.PushFront(1)
 	q.PushFront(2)
 	q.PushFront(3)
@@ -60,7 +61,7 @@ func TestBackQueue(t *testing.T) {
 }
 
 func TestBackStack(t *testing.T) {
-	q := NewDeque()
+	q := NewDeque[int]()
 	q.PushBack(1)
 	q.PushBack(2)
 	q.PushBack(3)
@@ -86,7 +87,7 @@ func TestBackStack(t *testing.T) {
 }
 
 func TestFrontStack(t *testing.T) {
-	q := NewDeque()
+	q := NewDeque[int]()
 	q.PushFront(1)
 	q.PushFront(2)
 	q.PushFront(3)
@@ -112,7 +113,7 @@ func TestFrontStack(t *testing.T) {
 }
 
 func TestResize(t *testing.T) {
-	q := NewDequeWithCapacity(0)
+	q := NewDequeWithCapacity[int](0)
 	assert.Equal(t, 0, len(q.data))
 
 	q.PushBack(1)
@@ -143,3 +144,420 @@ func TestResize(t *testing.T) {
 	}
 	assert.Equal(t, 0, q.Len())
 }
+
+func TestOpDeque(t *testing.T) {
+	var q OpDeque = NewOpDeque()
+	q.PushBack(1)
+	q.PushBack("two")
+	v, err := q.PopFront()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+	v, err = q.PopFront()
+	assert.Nil(t, err)
+	assert.Equal(t, "two", v)
+
+	q = NewOpDequeWithCapacity(3)
+	assert.Equal(t, 4, q.Cap())
+}
+
+func TestTyped(t *testing.T) {
+	type point struct{ x, y int }
+	q := NewDeque[point]()
+	q.PushBack(point{1, 2})
+	q.PushFront(point{3, 4})
+
+	v, err := q.PopBack()
+	assert.Nil(t, err)
+	assert.Equal(t, point{1, 2}, v)
+	v, err = q.PopBack()
+	assert.Nil(t, err)
+	assert.Equal(t, point{3, 4}, v)
+
+	// Popping an empty deque returns the zero value.
+	v, err = q.PopFront()
+	assert.NotNil(t, err)
+	assert.Equal(t, point{}, v)
+
+	// Values are stored unboxed, so pushing doesn't allocate once there's capacity.
+	allocs := testing.AllocsPerRun(100, func() {
+		q.PushBack(point{5, 6})
+		q.PopFront()
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestRandomAccess(t *testing.T) {
+	q := NewDequeWithCapacity[int](4)
+	_, err := q.Front()
+	assert.NotNil(t, err)
+	_, err = q.Back()
+	assert.NotNil(t, err)
+
+	// Wrap around the end of the buffer: 3 4 T H 1 2 -> positions 0 1 2 3 hold 1 2 3 4.
+	q.PushBack(0)
+	q.PushBack(0)
+	q.PushBack(1)
+	q.PushBack(2)
+	q.PopFront()
+	q.PopFront()
+	q.PushBack(3)
+	q.PushBack(4)
+	assert.Equal(t, 4, len(q.data))
+
+	v, err := q.Front()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+	v, err = q.Back()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, v)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, i+1, q.At(i))
+	}
+
+	q.Set(3, 40)
+	assert.Equal(t, 40, q.At(3))
+	v, _ = q.Back()
+	assert.Equal(t, 40, v)
+	assert.Panics(t, func() { q.At(4) })
+	assert.Panics(t, func() { q.At(-1) })
+	assert.Panics(t, func() { q.Set(4, 0) })
+
+	var got []int
+	q.Iter(func(i int, v int) bool {
+		assert.Equal(t, len(got), i)
+		got = append(got, v)
+		return true
+	})
+	assert.Equal(t, []int{1, 2, 3, 40}, got)
+
+	got = nil
+	q.IterBack(func(i int, v int) bool {
+		got = append(got, v)
+		return i > 2
+	})
+	assert.Equal(t, []int{40, 3}, got)
+
+	// Clear keeps the buffer and zeroes the elements.
+	q.Clear()
+	assert.Equal(t, 0, q.Len())
+	assert.Equal(t, []int{0, 0, 0, 0}, q.data)
+	assert.Panics(t, func() { q.At(0) })
+	q.PushBack(5)
+	q.PushFront(6)
+	assert.Equal(t, 4, len(q.data))
+	assert.Equal(t, 6, q.At(0))
+	assert.Equal(t, 5, q.At(1))
+}
+
+func TestShrink(t *testing.T) {
+	q := NewDequeWithCapacity[int](4)
+	for i := 0; i < 64; i++ {
+		q.PushBack(i)
+	}
+	assert.Equal(t, 64, q.Cap())
+
+	// The buffer is halved once it falls below a quarter full, which leaves it half full.
+	for i := 0; i < 48; i++ {
+		q.PopFront()
+	}
+	assert.Equal(t, 64, q.Cap())
+	q.PopFront()
+	assert.Equal(t, 32, q.Cap())
+	assert.Equal(t, 15, q.Len())
+
+	// Oscillating around the threshold doesn't reallocate.
+	for i := 0; i < 10; i++ {
+		q.PushBack(i)
+		q.PopFront()
+	}
+	assert.Equal(t, 32, q.Cap())
+
+	// It never shrinks below the initial capacity by itself.
+	for q.Len() > 0 {
+		q.PopBack()
+	}
+	assert.Equal(t, 4, q.Cap())
+}
+
+func TestCapacityManagement(t *testing.T) {
+	q := NewDequeWithCapacity[int](3)
+	assert.Equal(t, 4, q.Cap())
+	q.Reserve(4)
+	assert.Equal(t, 4, q.Cap())
+
+	// Wrap around the end of the buffer and make sure resizing keeps the order.
+	q.PushBack(0)
+	q.PushBack(1)
+	q.PushBack(2)
+	q.PopFront()
+	q.PushBack(3)
+	q.PushBack(4)
+	q.Reserve(5)
+	assert.Equal(t, 16, q.Cap())
+	for i := 5; i <= 9; i++ {
+		q.PushBack(i)
+	}
+	assert.Equal(t, 16, q.Cap())
+	assert.Equal(t, 9, q.Len())
+	for i := 0; i < 9; i++ {
+		assert.Equal(t, i+1, q.At(i))
+	}
+
+	for q.Len() > 3 {
+		q.PopBack()
+	}
+	q.ShrinkToFit()
+	assert.Equal(t, 4, q.Cap())
+	q.PushFront(0)
+	q.PushFront(-1)
+	assert.Equal(t, 8, q.Cap())
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, i-1, q.At(i))
+	}
+
+	q.Clear()
+	q.ShrinkToFit()
+	assert.Equal(t, 0, q.Cap())
+	q.PushBack(1)
+	assert.Equal(t, 1, q.At(0))
+}
+
+func TestAgainstSlice(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	q := NewDequeWithCapacity[int](0)
+	var want []int
+	for i := 0; i < 10000; i++ {
+		switch rnd.Intn(4) {
+		case 0:
+			q.PushBack(i)
+			want = append(want, i)
+		case 1:
+			q.PushFront(i)
+			want = append([]int{i}, want...)
+		case 2:
+			v, err := q.PopBack()
+			if len(want) == 0 {
+				assert.NotNil(t, err)
+				continue
+			}
+			assert.Equal(t, want[len(want)-1], v)
+			want = want[:len(want)-1]
+		case 3:
+			v, err := q.PopFront()
+			if len(want) == 0 {
+				assert.NotNil(t, err)
+				continue
+			}
+			assert.Equal(t, want[0], v)
+			want = want[1:]
+		}
+		assert.Equal(t, len(want), q.Len())
+		// The capacity is always a power of two.
+		assert.Zero(t, q.Cap()&(q.Cap()-1))
+	}
+	for i, v := range want {
+		assert.Equal(t, v, q.At(i))
+	}
+}
+
+func contents(q *Deque[int]) []int {
+	res := []int{}
+	q.Iter(func(_ int, v int) bool {
+		res = append(res, v)
+		return true
+	})
+	return res
+}
+
+func TestInsertRemove(t *testing.T) {
+	q := NewDequeWithCapacity[int](4)
+	q.Insert(0, 2)
+	q.Insert(0, 0)
+	q.Insert(1, 1)
+	q.Insert(3, 4)
+	q.Insert(3, 3)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, contents(&q))
+	assert.Panics(t, func() { q.Insert(6, 0) })
+	assert.Panics(t, func() { q.Insert(-1, 0) })
+
+	assert.Equal(t, 1, q.Remove(1))
+	assert.Equal(t, 3, q.Remove(2))
+	assert.Equal(t, []int{0, 2, 4}, contents(&q))
+	assert.Panics(t, func() { q.Remove(3) })
+
+	q.Swap(0, 2)
+	assert.Equal(t, []int{4, 2, 0}, contents(&q))
+	assert.Panics(t, func() { q.Swap(0, 3) })
+	q.Reverse()
+	assert.Equal(t, []int{0, 2, 4}, contents(&q))
+}
+
+func TestRotate(t *testing.T) {
+	// With 8 elements the buffer is full, which rotates by moving the head alone.
+	for _, size := range []int{5, 8} {
+		q := NewDequeWithCapacity[int](8)
+		// Start somewhere in the middle of the buffer, so rotation has to wrap around.
+		q.PushBack(0)
+		q.PushBack(0)
+		q.PopFront()
+		q.PopFront()
+		want := make([]int, size)
+		for i := range want {
+			q.PushBack(i)
+			want[i] = i
+		}
+		rotated := append(append([]int{}, want[size-2:]...), want[:size-2]...)
+		q.Rotate(2)
+		assert.Equal(t, rotated, contents(&q))
+		q.Rotate(-2)
+		assert.Equal(t, want, contents(&q))
+		q.Rotate(size - 2)
+		q.Rotate(4 - size)
+		assert.Equal(t, rotated, contents(&q))
+		q.Rotate(-2 - 3*size)
+		assert.Equal(t, want, contents(&q))
+		q.Rotate(size)
+		assert.Equal(t, want, contents(&q))
+		assert.Equal(t, 8, q.Cap())
+	}
+}
+
+func TestMiddleOpsAgainstSlice(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	q := NewDequeWithCapacity[int](0)
+	want := []int{}
+	for i := 0; i < 5000; i++ {
+		switch op := rnd.Intn(5); {
+		case op < 2:
+			j := rnd.Intn(len(want) + 1)
+			q.Insert(j, i)
+			want = append(want[:j], append([]int{i}, want[j:]...)...)
+		case op == 2 && len(want) > 0:
+			j := rnd.Intn(len(want))
+			assert.Equal(t, want[j], q.Remove(j))
+			want = append(want[:j], want[j+1:]...)
+		case op == 3 && len(want) > 0:
+			n := rnd.Intn(2*len(want)) - len(want)
+			q.Rotate(n)
+			k := ((n % len(want)) + len(want)) % len(want)
+			want = append(append([]int{}, want[len(want)-k:]...), want[:len(want)-k]...)
+		case op == 4 && len(want) > 0:
+			a, b := rnd.Intn(len(want)), rnd.Intn(len(want))
+			q.Swap(a, b)
+			want[a], want[b] = want[b], want[a]
+			if rnd.Intn(10) == 0 {
+				q.Reverse()
+				for l, r := 0, len(want)-1; l < r; l, r = l+1, r-1 {
+					want[l], want[r] = want[r], want[l]
+				}
+			}
+		}
+		assert.Equal(t, want, contents(&q))
+	}
+}
+
+func TestBulk(t *testing.T) {
+	q := NewDequeWithCapacity[int](4)
+	q.PushBackN(nil)
+	assert.Equal(t, 4, q.Cap())
+	// Move the head to the middle of the buffer, so bulk operations have to wrap around.
+	q.PushBackN([]int{0, 0, 0})
+	assert.Equal(t, []int{0, 0}, q.PopFrontN(2))
+	q.PushBackN([]int{1, 2, 3})
+	assert.Equal(t, 4, q.Cap())
+	assert.Equal(t, []int{0, 1, 2, 3}, q.ToSlice())
+
+	dst := make([]int, 2)
+	assert.Equal(t, 2, q.CopyTo(dst))
+	assert.Equal(t, []int{0, 1}, dst)
+	dst = make([]int, 6)
+	assert.Equal(t, 4, q.CopyTo(dst))
+	assert.Equal(t, []int{0, 1, 2, 3, 0, 0}, dst)
+
+	// Growing keeps the order and only happens once.
+	q.PushBackN([]int{4, 5, 6, 7, 8})
+	assert.Equal(t, 16, q.Cap())
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8}, q.ToSlice())
+
+	assert.Equal(t, []int{0, 1, 2}, q.PopFrontN(3))
+	assert.Equal(t, 6, q.Len())
+	assert.Equal(t, []int{3, 4, 5, 6, 7, 8}, q.PopFrontN(10))
+	assert.Nil(t, q.PopFrontN(1))
+	assert.Equal(t, []int{}, q.ToSlice())
+	// Popped slots are zeroed.
+	for _, v := range q.data {
+		assert.Equal(t, 0, v)
+	}
+}
+
+func TestDrainTo(t *testing.T) {
+	q := NewDequeWithCapacity[int](4)
+	q.PushBack(0)
+	q.PopFront()
+	for i := 1; i <= 100; i++ {
+		q.PushBack(i)
+	}
+	assert.Equal(t, 128, q.Cap())
+	var got []int
+	q.DrainTo(func(v int) { got = append(got, v) })
+	assert.Equal(t, 100, len(got))
+	assert.Equal(t, 1, got[0])
+	assert.Equal(t, 100, got[99])
+	assert.Equal(t, 0, q.Len())
+	// Draining a similar number of elements again doesn't shrink the buffer.
+	assert.Equal(t, 128, q.Cap())
+
+	for i := 0; i < 10; i++ {
+		q.PushBack(i)
+	}
+	got = nil
+	q.DrainTo(func(v int) { got = append(got, v) })
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got)
+	assert.Equal(t, 32, q.Cap())
+
+	q.DrainTo(func(int) { t.Fail() })
+	assert.Equal(t, 4, q.Cap())
+	q.PushBack(1)
+	assert.Equal(t, []int{1}, q.ToSlice())
+}
+
+func TestEmpty(t *testing.T) {
+	q := NewDeque[int]()
+	_, err := q.PopFront()
+	assert.ErrorIs(t, err, ErrEmpty)
+	_, err = q.PopBack()
+	assert.ErrorIs(t, err, ErrEmpty)
+	_, err = q.Front()
+	assert.ErrorIs(t, err, ErrEmpty)
+	_, err = q.Back()
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	v, ok := q.TryPopFront()
+	assert.False(t, ok)
+	assert.Equal(t, 0, v)
+	_, ok = q.TryPopBack()
+	assert.False(t, ok)
+	assert.PanicsWithValue(t, ErrEmpty, func() { q.MustPopFront() })
+	assert.PanicsWithValue(t, ErrEmpty, func() { q.MustPopBack() })
+
+	// Empty pops don't allocate.
+	allocs := testing.AllocsPerRun(100, func() {
+		q.PopFront()
+		q.PopBack()
+		q.TryPopFront()
+	})
+	assert.Equal(t, 0.0, allocs)
+
+	q.PushBack(1)
+	q.PushBack(2)
+	q.PushBack(3)
+	v, ok = q.TryPopFront()
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, ok = q.TryPopBack()
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, 2, q.MustPopFront())
+	q.PushFront(4)
+	assert.Equal(t, 4, q.MustPopBack())
+}
@@ -0,0 +1,31 @@
+//go:build go1.23
+
+package deque
+
+import "iter"
+
+// All returns an iterator over positions and elements from front to back, for use with range. The deque must not be
+// modified while iterating.
+func (q *Deque[T]) All() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		q.Iter(yield)
+	}
+}
+
+// Backward returns an iterator over positions and elements from back to front, for use with range. The deque must not
+// be modified while iterating.
+func (q *Deque[T]) Backward() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		q.IterBack(yield)
+	}
+}
+
+// Values returns an iterator over elements from front to back, for use with range. The deque must not be modified
+// while iterating.
+func (q *Deque[T]) Values() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		q.Iter(func(_ int, v T) bool {
+			return yield(v)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+//go:build go1.23
+
+package deque
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeOverFunc(t *testing.T) {
+	q := NewDequeWithCapacity[int](4)
+	for i := 1; i <= 4; i++ {
+		q.PushFront(i)
+	}
+
+	var got []int
+	for i, v := range q.All() {
+		assert.Equal(t, len(got), i)
+		got = append(got, v)
+	}
+	assert.Equal(t, []int{4, 3, 2, 1}, got)
+
+	got = nil
+	for _, v := range q.Backward() {
+		if v == 3 {
+			break
+		}
+		got = append(got, v)
+	}
+	assert.Equal(t, []int{1, 2}, got)
+
+	got = nil
+	for v := range q.Values() {
+		got = append(got, v)
+	}
+	assert.Equal(t, []int{4, 3, 2, 1}, got)
+}
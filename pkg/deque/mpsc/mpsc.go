@@ -0,0 +1,107 @@
+package mpsc
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Link makes a type usable as an element of a Queue. Embed it in the element type, e.g.
+//
+//	type job struct {
+//		mpsc.Link
+//		id int
+//	}
+//
+// The queue threads its list through the embedded links, so pushing doesn't allocate.
+type Link struct {
+	// next points to the element after this one, a *T.
+	next unsafe.Pointer
+}
+
+func (l *Link) link() *Link {
+	return l
+}
+
+// Linked is satisfied by pointers to types that embed Link.
+type Linked[T any] interface {
+	*T
+	link() *Link
+}
+
+// Queue is an unbounded intrusive multi-producer single-consumer queue, following Dmitry Vyukov's design. Push can be
+// called from any number of go routines, while Pop and Empty must only be called by a single consumer go routine.
+//
+// The queue links the elements themselves instead of allocating nodes, so an element must not be pushed again before
+// it was popped. Once popped, it belongs to the caller again and can be reused, e.g. handed back to a producer.
+//
+// Push is wait-free: a single atomic swap links the new element in. Pop never blocks either, but between that swap
+// and the producer linking the previous element to the new one, the consumer can't see past the previous element.
+// During that short window Pop reports the queue as empty, even if other elements were pushed afterwards, so consumers
+// should treat an empty result as "nothing right now" and poll again.
+type Queue[T any, P Linked[T]] struct {
+	// head is the most recently pushed element. Swapped by producers.
+	head unsafe.Pointer
+	// tail is the element at the front of the queue, or the stub. Only accessed by the consumer.
+	tail unsafe.Pointer
+	// stub is a dummy element that keeps the list from ever being empty, so producers never touch tail.
+	stub unsafe.Pointer
+}
+
+// New creates an empty Queue of *T elements.
+func New[T any, P Linked[T]]() *Queue[T, P] {
+	stub := unsafe.Pointer(new(T))
+	return &Queue[T, P]{head: stub, tail: stub, stub: stub}
+}
+
+// next returns a pointer to the next field of the element e.
+func next[T any, P Linked[T]](e unsafe.Pointer) *unsafe.Pointer {
+	return &P((*T)(e)).link().next
+}
+
+// Push adds an element to the back of the queue. Safe to call from any go routine.
+func (q *Queue[T, P]) Push(v P) {
+	q.push(unsafe.Pointer(v))
+}
+
+func (q *Queue[T, P]) push(e unsafe.Pointer) {
+	atomic.StorePointer(next[T, P](e), nil)
+	prev := atomic.SwapPointer(&q.head, e)
+	atomic.StorePointer(next[T, P](prev), e)
+}
+
+// Pop removes and returns the element at the front of the queue. Returns nil and false if the queue is empty, or a
+// Push that precedes the front is still in progress. Must only be called by the consumer.
+func (q *Queue[T, P]) Pop() (P, bool) {
+	tail := q.tail
+	nxt := atomic.LoadPointer(next[T, P](tail))
+	if tail == q.stub {
+		// Skip over the stub.
+		if nxt == nil {
+			return nil, false
+		}
+		q.tail = nxt
+		tail = nxt
+		nxt = atomic.LoadPointer(next[T, P](nxt))
+	}
+	if nxt != nil {
+		q.tail = nxt
+		return P((*T)(tail)), true
+	}
+	if tail != atomic.LoadPointer(&q.head) {
+		// A producer swapped head, but didn't link it to tail yet.
+		return nil, false
+	}
+	// tail is the last element. Push the stub behind it, so we can hand tail out without leaving the list empty.
+	q.push(q.stub)
+	if nxt = atomic.LoadPointer(next[T, P](tail)); nxt != nil {
+		q.tail = nxt
+		return P((*T)(tail)), true
+	}
+	// Another producer got in between tail and the stub and is still linking.
+	return nil, false
+}
+
+// Empty returns true if there is nothing to pop right now. Must only be called by the consumer.
+func (q *Queue[T, P]) Empty() bool {
+	return q.tail == q.stub && atomic.LoadPointer(next[T, P](q.stub)) == nil
+}
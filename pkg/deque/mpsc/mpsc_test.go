@@ -0,0 +1,90 @@
+package mpsc
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	Link
+	value int
+}
+
+func TestBasic(t *testing.T) {
+	q := New[item]()
+	assert.True(t, q.Empty())
+	_, ok := q.Pop()
+	assert.False(t, ok)
+
+	a, b := &item{value: 1}, &item{value: 2}
+	q.Push(a)
+	q.Push(b)
+	assert.False(t, q.Empty())
+	v, ok := q.Pop()
+	assert.True(t, ok)
+	assert.Same(t, a, v)
+	v, ok = q.Pop()
+	assert.True(t, ok)
+	assert.Same(t, b, v)
+	_, ok = q.Pop()
+	assert.False(t, ok)
+	assert.True(t, q.Empty())
+
+	// Popped elements can be pushed again.
+	q.Push(b)
+	q.Push(a)
+	v, _ = q.Pop()
+	assert.Same(t, b, v)
+	q.Push(b)
+	v, _ = q.Pop()
+	assert.Same(t, a, v)
+	v, _ = q.Pop()
+	assert.Same(t, b, v)
+	assert.True(t, q.Empty())
+}
+
+func TestNoAllocations(t *testing.T) {
+	q := New[item]()
+	e := &item{}
+	allocs := testing.AllocsPerRun(100, func() {
+		q.Push(e)
+		q.Pop()
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestConcurrentProducers(t *testing.T) {
+	q := New[item]()
+	const producers, perProducer = 8, 10000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Push(&item{value: p*perProducer + i})
+			}
+		}(p)
+	}
+
+	// Elements of every single producer come out in the order it pushed them.
+	next := make([]int, producers)
+	for got := 0; got < producers*perProducer; {
+		e, ok := q.Pop()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		p := e.value / perProducer
+		if !assert.Equal(t, next[p], e.value%perProducer) {
+			return
+		}
+		next[p]++
+		got++
+	}
+	wg.Wait()
+	assert.True(t, q.Empty())
+}
@@ -1,6 +1,13 @@
 package deque
 
-import "testing"
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/bitstonks/leftright/pkg/deque/mpsc"
+	"github.com/bitstonks/leftright/pkg/deque/spsc"
+)
 
 func BenchmarkChan_FillDrain(b *testing.B) {
 	c := make(chan int, b.N)
@@ -14,7 +21,7 @@ func BenchmarkChan_FillDrain(b *testing.B) {
 }
 
 func BenchmarkDeque_FillDrain(b *testing.B) {
-	d := NewDequeWithCapacity(b.N)
+	d := NewDequeWithCapacity[int](b.N)
 	for i := 0; i < b.N; i++ {
 		d.PushBack(i)
 	}
@@ -32,7 +39,7 @@ func BenchmarkChan_Push(b *testing.B) {
 }
 
 func BenchmarkDeque_Push(b *testing.B) {
-	d := NewDequeWithCapacity(b.N)
+	d := NewDequeWithCapacity[int](b.N)
 	for i := 0; i < b.N; i++ {
 		d.PushBack(i)
 	}
@@ -47,7 +54,7 @@ func BenchmarkChan_Queue(b *testing.B) {
 }
 
 func BenchmarkDeque_Queue(b *testing.B) {
-	d := NewDequeWithCapacity(1)
+	d := NewDequeWithCapacity[int](1)
 	for i := 0; i < b.N; i++ {
 		d.PushBack(i)
 		d.PopFront()
@@ -65,7 +72,7 @@ func BenchmarkChan_Queue2(b *testing.B) {
 }
 
 func BenchmarkDeque_Queue2(b *testing.B) {
-	d := NewDequeWithCapacity(2)
+	d := NewDequeWithCapacity[int](2)
 	for i := 0; i < b.N/2; i++ {
 		d.PushBack(i)
 		d.PushBack(i)
@@ -73,3 +80,156 @@ func BenchmarkDeque_Queue2(b *testing.B) {
 		d.PopFront()
 	}
 }
+
+func BenchmarkChan_Steady(b *testing.B) {
+	c := make(chan int, 1024)
+	for i := 0; i < 1000; i++ {
+		c <- i
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c <- i
+		<-c
+	}
+}
+
+// BenchmarkDeque_Steady keeps the deque partially full, so head and tail keep wrapping around the end of the buffer.
+func BenchmarkDeque_Steady(b *testing.B) {
+	d := NewDequeWithCapacity[int](1024)
+	for i := 0; i < 1000; i++ {
+		d.PushBack(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.PushBack(i)
+		d.PopFront()
+	}
+}
+
+// BenchmarkDeque_Grow pushes without preallocating, so it includes the cost of growing the buffer. Channels can't
+// grow, so compare it against BenchmarkChan_Push, which allocates everything upfront.
+func BenchmarkDeque_Grow(b *testing.B) {
+	d := NewDeque[int]()
+	for i := 0; i < b.N; i++ {
+		d.PushBack(i)
+	}
+}
+
+// BenchmarkDeque_GrowWrapped is like BenchmarkDeque_Grow, but the elements wrap around the end of the buffer every
+// time it grows, which needs the most copying.
+func BenchmarkDeque_GrowWrapped(b *testing.B) {
+	d := NewDeque[int]()
+	for i := 0; i < b.N; i++ {
+		d.PushFront(i)
+	}
+}
+
+func BenchmarkChan_ProducerConsumer(b *testing.B) {
+	c := make(chan int, 64)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			c <- i
+		}
+		close(c)
+	}()
+	for range c {
+	}
+}
+
+func BenchmarkSyncDeque_ProducerConsumer(b *testing.B) {
+	s := NewBoundedSyncDeque[int](64)
+	ctx := context.Background()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			s.PushBackWait(ctx, i)
+		}
+		s.Close()
+	}()
+	for {
+		if _, err := s.PopFrontWait(ctx); err != nil {
+			return
+		}
+	}
+}
+
+func BenchmarkSPSC_Queue(b *testing.B) {
+	q := spsc.New[int](1)
+	for i := 0; i < b.N; i++ {
+		q.Push(i)
+		q.Pop()
+	}
+}
+
+type mpscItem struct {
+	mpsc.Link
+	value int
+}
+
+func BenchmarkMPSC_Queue(b *testing.B) {
+	b.ReportAllocs()
+	q := mpsc.New[mpscItem]()
+	e := &mpscItem{}
+	for i := 0; i < b.N; i++ {
+		e.value = i
+		q.Push(e)
+		q.Pop()
+	}
+}
+
+func BenchmarkSPSC_ProducerConsumer(b *testing.B) {
+	q := spsc.New[int](64)
+	go func() {
+		for i := 0; i < b.N; {
+			if q.Push(i) {
+				i++
+			} else {
+				runtime.Gosched()
+			}
+		}
+	}()
+	for i := 0; i < b.N; {
+		if _, ok := q.Pop(); ok {
+			i++
+		} else {
+			runtime.Gosched()
+		}
+	}
+}
+
+func BenchmarkChan_MultiProducer(b *testing.B) {
+	b.ReportAllocs()
+	c := make(chan int, 64)
+	for p := 0; p < 4; p++ {
+		go func() {
+			for i := 0; i < b.N/4; i++ {
+				c <- i
+			}
+		}()
+	}
+	for i := 0; i < b.N/4*4; i++ {
+		<-c
+	}
+}
+
+func BenchmarkMPSC_MultiProducer(b *testing.B) {
+	b.ReportAllocs()
+	q := mpsc.New[mpscItem]()
+	// The elements are allocated up front, the queue itself doesn't allocate.
+	items := make([]mpscItem, b.N/4*4)
+	b.ResetTimer()
+	for p := 0; p < 4; p++ {
+		go func(items []mpscItem) {
+			for i := range items {
+				items[i].value = i
+				q.Push(&items[i])
+			}
+		}(items[p*(b.N/4) : (p+1)*(b.N/4)])
+	}
+	for i := 0; i < b.N/4*4; {
+		if _, ok := q.Pop(); ok {
+			i++
+		} else {
+			runtime.Gosched()
+		}
+	}
+}
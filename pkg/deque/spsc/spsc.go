@@ -0,0 +1,86 @@
+package spsc
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// cacheLine is the assumed size of a CPU cache line. Indices written by different go routines are kept on separate
+// cache lines, so the producer and the consumer don't keep invalidating each other's caches.
+const cacheLine = 64
+
+// Queue is a bounded single-producer single-consumer queue implemented with a ring buffer. Push must only be called
+// by one go routine and Pop by one (possibly different) go routine, while Len can be called from anywhere. Both Push
+// and Pop are wait-free: they never block and finish in a bounded number of steps, returning false if the queue is
+// full or empty.
+type Queue[T any] struct {
+	// head is the number of elements popped so far. Only written by the consumer. Kept first in the struct, so it is
+	// 64-bit aligned for atomic access on 32-bit platforms.
+	head uint64
+	// cachedTail is the consumer's copy of tail, refreshed only when the queue looks empty.
+	cachedTail uint64
+	_          [cacheLine - 16]byte
+	// tail is the number of elements pushed so far. Only written by the producer.
+	tail uint64
+	// cachedHead is the producer's copy of head, refreshed only when the queue looks full.
+	cachedHead uint64
+	_          [cacheLine - 16]byte
+	// data holds the elements. Its length is a power of two, so the element number i is stored at index i & mask.
+	data []T
+	mask uint64
+}
+
+// New creates an empty Queue holding at most capacity elements, rounded up to a power of two. Panics if capacity is
+// not positive.
+func New[T any](capacity int) *Queue[T] {
+	if capacity <= 0 {
+		panic("spsc: capacity must be positive")
+	}
+	capacity = 1 << bits.Len(uint(capacity-1))
+	return &Queue[T]{data: make([]T, capacity), mask: uint64(capacity - 1)}
+}
+
+// Cap returns the maximum number of elements in the queue.
+func (q *Queue[T]) Cap() int {
+	return len(q.data)
+}
+
+// Len returns the number of elements in the queue. When called concurrently with Push or Pop it is only a snapshot.
+func (q *Queue[T]) Len() int {
+	head := atomic.LoadUint64(&q.head)
+	return int(atomic.LoadUint64(&q.tail) - head)
+}
+
+// Push adds an element to the back of the queue. Returns false if the queue is full. Must only be called by the
+// producer.
+func (q *Queue[T]) Push(v T) bool {
+	tail := q.tail
+	if tail-q.cachedHead == uint64(len(q.data)) {
+		q.cachedHead = atomic.LoadUint64(&q.head)
+		if tail-q.cachedHead == uint64(len(q.data)) {
+			return false
+		}
+	}
+	q.data[tail&q.mask] = v
+	// Publishing the new tail makes the element visible to the consumer.
+	atomic.StoreUint64(&q.tail, tail+1)
+	return true
+}
+
+// Pop removes and returns the element at the front of the queue. Returns the zero value and false if the queue is
+// empty. Must only be called by the consumer.
+func (q *Queue[T]) Pop() (T, bool) {
+	var zero T
+	head := q.head
+	if head == q.cachedTail {
+		q.cachedTail = atomic.LoadUint64(&q.tail)
+		if head == q.cachedTail {
+			return zero, false
+		}
+	}
+	v := q.data[head&q.mask]
+	// Clear the slot to prevent memory leaks, before handing it back to the producer.
+	q.data[head&q.mask] = zero
+	atomic.StoreUint64(&q.head, head+1)
+	return v, true
+}
@@ -0,0 +1,68 @@
+package spsc
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasic(t *testing.T) {
+	q := New[int](3)
+	assert.Equal(t, 4, q.Cap())
+	_, ok := q.Pop()
+	assert.False(t, ok)
+
+	// Go around the ring a few times.
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 4; i++ {
+			assert.True(t, q.Push(i))
+		}
+		assert.False(t, q.Push(4))
+		assert.Equal(t, 4, q.Len())
+		for i := 0; i < 4; i++ {
+			v, ok := q.Pop()
+			assert.True(t, ok)
+			assert.Equal(t, i, v)
+		}
+		_, ok = q.Pop()
+		assert.False(t, ok)
+		assert.Equal(t, 0, q.Len())
+	}
+	// Popped slots are cleared.
+	assert.Equal(t, []int{0, 0, 0, 0}, q.data)
+}
+
+func TestInvalidCapacity(t *testing.T) {
+	assert.Panics(t, func() { New[int](0) })
+}
+
+func TestConcurrent(t *testing.T) {
+	q := New[int](16)
+	const n = 100000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; {
+			if q.Push(i) {
+				i++
+			} else {
+				runtime.Gosched()
+			}
+		}
+	}()
+	for want := 0; want < n; {
+		v, ok := q.Pop()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		if v != want {
+			assert.Equal(t, want, v)
+			return
+		}
+		want++
+	}
+	<-done
+	assert.Equal(t, 0, q.Len())
+}
@@ -0,0 +1,188 @@
+package deque
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned when pushing to a closed SyncDeque, or popping from one that is closed and empty.
+var ErrClosed = errors.New("deque is closed")
+
+// SyncDeque is a double ended queue that is safe for concurrent use by multiple go routines. Besides non-blocking
+// pushes and pops it has blocking variants that wait for an element (or for room, if bounded) until the context is
+// done, which makes it usable as a job queue, or for work stealing, where the owner pops from one end and thieves from
+// the other.
+//
+// Like a channel, a SyncDeque can be closed, after which pushes fail with ErrClosed, while pops keep returning the
+// remaining elements until the deque is empty and then fail with ErrClosed as well.
+type SyncDeque[T any] struct {
+	mu sync.Mutex
+	// q holds the elements. It rejects pushes once full, so blocking pushes know when to wait.
+	q      BoundedDeque[T]
+	closed bool
+	// notEmpty and notFull are closed to wake up go routines waiting to pop and push respectively. They are created
+	// by the first waiter and reset once closed, so they don't cost anything if nobody waits.
+	notEmpty chan struct{}
+	notFull  chan struct{}
+}
+
+// NewSyncDeque creates a new unbounded SyncDeque.
+func NewSyncDeque[T any]() *SyncDeque[T] {
+	return NewBoundedSyncDeque[T](0)
+}
+
+// NewBoundedSyncDeque creates a new SyncDeque holding at most maxLen elements. A non-positive maxLen means no limit.
+func NewBoundedSyncDeque[T any](maxLen int) *SyncDeque[T] {
+	return &SyncDeque[T]{q: NewBoundedDeque[T](maxLen, Reject)}
+}
+
+// wake wakes up all go routines waiting on the given channel. Must be called with mu held.
+func wake(ch *chan struct{}) {
+	if *ch != nil {
+		close(*ch)
+		*ch = nil
+	}
+}
+
+// waitOn returns the channel to wait on, creating it if needed. Must be called with mu held.
+func waitOn(ch *chan struct{}) chan struct{} {
+	if *ch == nil {
+		*ch = make(chan struct{})
+	}
+	return *ch
+}
+
+// Len returns the number of elements in the deque.
+func (s *SyncDeque[T]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.q.Len()
+}
+
+// Close closes the deque. Pushes fail from now on, while pops return the remaining elements. All blocked go routines
+// wake up. Closing a closed deque does nothing.
+func (s *SyncDeque[T]) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	wake(&s.notEmpty)
+	wake(&s.notFull)
+}
+
+// push adds an element to either end without waiting. Must be called with mu held.
+func (s *SyncDeque[T]) push(v T, back bool) error {
+	if s.closed {
+		return ErrClosed
+	}
+	var err error
+	if back {
+		err = s.q.PushBack(v)
+	} else {
+		err = s.q.PushFront(v)
+	}
+	if err == nil {
+		wake(&s.notEmpty)
+	}
+	return err
+}
+
+// pop removes an element from either end without waiting. Must be called with mu held.
+func (s *SyncDeque[T]) pop(back bool) (T, bool) {
+	var v T
+	var ok bool
+	if back {
+		v, ok = s.q.TryPopBack()
+	} else {
+		v, ok = s.q.TryPopFront()
+	}
+	if ok {
+		wake(&s.notFull)
+	}
+	return v, ok
+}
+
+// PushBack inserts a new element at the end. Returns ErrFull if the deque is bounded and full, or ErrClosed if it is
+// closed.
+func (s *SyncDeque[T]) PushBack(v T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.push(v, true)
+}
+
+// PushFront inserts a new element at the start. Returns ErrFull if the deque is bounded and full, or ErrClosed if it
+// is closed.
+func (s *SyncDeque[T]) PushFront(v T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.push(v, false)
+}
+
+// PushBackWait inserts a new element at the end, waiting for room if the deque is bounded and full. Returns ErrClosed
+// if the deque is or gets closed, or the context error if it is done first.
+func (s *SyncDeque[T]) PushBackWait(ctx context.Context, v T) error {
+	for {
+		s.mu.Lock()
+		err := s.push(v, true)
+		if err != ErrFull {
+			s.mu.Unlock()
+			return err
+		}
+		wait := waitOn(&s.notFull)
+		s.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryPopFront removes and returns the first element. Returns the zero value and false if the deque is empty.
+func (s *SyncDeque[T]) TryPopFront() (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pop(false)
+}
+
+// TryPopBack removes and returns the last element. Returns the zero value and false if the deque is empty.
+func (s *SyncDeque[T]) TryPopBack() (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pop(true)
+}
+
+// PopFrontWait removes and returns the first element, waiting for one if the deque is empty. Returns ErrClosed if the
+// deque is closed and empty, or the context error if it is done first.
+func (s *SyncDeque[T]) PopFrontWait(ctx context.Context) (T, error) {
+	return s.popWait(ctx, false)
+}
+
+// PopBackWait removes and returns the last element, waiting for one if the deque is empty. Returns ErrClosed if the
+// deque is closed and empty, or the context error if it is done first.
+func (s *SyncDeque[T]) PopBackWait(ctx context.Context) (T, error) {
+	return s.popWait(ctx, true)
+}
+
+func (s *SyncDeque[T]) popWait(ctx context.Context, back bool) (T, error) {
+	for {
+		s.mu.Lock()
+		if v, ok := s.pop(back); ok {
+			s.mu.Unlock()
+			return v, nil
+		}
+		if s.closed {
+			s.mu.Unlock()
+			var zero T
+			return zero, ErrClosed
+		}
+		wait := waitOn(&s.notEmpty)
+		s.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package deque
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncBasic(t *testing.T) {
+	s := NewSyncDeque[int]()
+	assert.Nil(t, s.PushBack(1))
+	assert.Nil(t, s.PushFront(0))
+	assert.Nil(t, s.PushBack(2))
+	assert.Equal(t, 3, s.Len())
+
+	v, ok := s.TryPopBack()
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	v, err := s.PopFrontWait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, v)
+
+	// Closing keeps the remaining elements poppable, but rejects pushes.
+	s.Close()
+	s.Close()
+	assert.ErrorIs(t, s.PushBack(3), ErrClosed)
+	assert.ErrorIs(t, s.PushBackWait(context.Background(), 3), ErrClosed)
+	v, err = s.PopBackWait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+	_, err = s.PopFrontWait(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+	_, ok = s.TryPopFront()
+	assert.False(t, ok)
+}
+
+func TestSyncContext(t *testing.T) {
+	s := NewBoundedSyncDeque[int](1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := s.PopFrontWait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Nil(t, s.PushBack(1))
+	assert.ErrorIs(t, s.PushFront(2), ErrFull)
+	assert.ErrorIs(t, s.PushBackWait(ctx, 2), context.DeadlineExceeded)
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestSyncWakeUp(t *testing.T) {
+	s := NewBoundedSyncDeque[int](1)
+	ctx := context.Background()
+	popped := make(chan int)
+	go func() {
+		v, _ := s.PopBackWait(ctx)
+		popped <- v
+	}()
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, s.PushBack(1))
+	assert.Equal(t, 1, <-popped)
+
+	// A blocked push goes through once there's room.
+	assert.Nil(t, s.PushBack(2))
+	pushed := make(chan error)
+	go func() { pushed <- s.PushBackWait(ctx, 3) }()
+	time.Sleep(time.Millisecond)
+	v, ok := s.TryPopFront()
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Nil(t, <-pushed)
+
+	// Closing wakes up blocked go routines.
+	go func() { pushed <- s.PushBackWait(ctx, 4) }()
+	time.Sleep(time.Millisecond)
+	s.Close()
+	assert.ErrorIs(t, <-pushed, ErrClosed)
+}
+
+func TestSyncProducerConsumer(t *testing.T) {
+	s := NewBoundedSyncDeque[int](8)
+	ctx := context.Background()
+	const producers, perProducer = 4, 1000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				assert.Nil(t, s.PushBackWait(ctx, p*perProducer+i))
+			}
+		}(p)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	var consumers sync.WaitGroup
+	for c := 0; c < 4; c++ {
+		consumers.Add(1)
+		go func(c int) {
+			defer consumers.Done()
+			for {
+				var v int
+				var err error
+				// Half the consumers steal from the other end.
+				if c%2 == 0 {
+					v, err = s.PopFrontWait(ctx)
+				} else {
+					v, err = s.PopBackWait(ctx)
+				}
+				if err != nil {
+					assert.ErrorIs(t, err, ErrClosed)
+					return
+				}
+				mu.Lock()
+				assert.False(t, seen[v])
+				seen[v] = true
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	s.Close()
+	consumers.Wait()
+	assert.Len(t, seen, producers*perProducer)
+}
@@ -1,12 +1,30 @@
+// Package lock implements the left-right concurrency primitive. A LeftRightLock keeps two copies of a
+// LeftRightStructure, one on each side of the lock. Readers read one side, while the single writer updates the other.
+//
+// The data structures in the lr* packages are built on a LeftRightLock, and the same rules apply to all of them:
+//   - Writes, including Publish, must only be made by a single writer (or be mutex synchronized). Reads are wait-free
+//     and can be made from any go routine.
+//   - Writes only become visible to readers after Publish. The one exception is Write on a lock created by
+//     NewBoundedLeftRightLock, which publishes by itself once the limit of unpublished operations is reached. Readers
+//     can then see a half-applied batch, so callers that need batches to be atomic should use TryWrite instead.
+//   - Every write is applied to both sides, so Update must be deterministic.
+//   - Values passed to writes end up on both sides and are handed out to readers, so they must not be mutated after
+//     they were written.
+//   - Reads that take a callback, like Iter or WalkPrefix, hold the read lock while it runs. Keep callbacks short, as
+//     they hold up the next Publish.
 package lock
 
 import (
+	"errors"
 	"runtime"
 	"sync/atomic"
 
 	"github.com/bitstonks/leftright/pkg/deque"
 )
 
+// ErrFull is returned by TryWrite when a bounded lock already holds the maximum number of unpublished operations.
+var ErrFull = errors.New("lock: too many unpublished operations")
+
 // Operation is the generic input accepted by the left-right data structure. Named for readability. Should be immutable.
 type Operation interface{}
 
@@ -24,8 +42,9 @@ type LeftRightStructure interface {
 type LeftRightLock struct {
 	// data holds the left and right structures, which we'll be reading and updating.
 	data [2]LeftRightStructure
-	// opQ is a queue used to store operations that were only applied on a single side of the structure.
-	opQ deque.Deque
+	// opQ is a queue used to store operations that were only applied on a single side of the structure. If it is
+	// bounded, Write publishes whenever it fills up, while TryWrite returns ErrFull.
+	opQ deque.BoundedDeque[deque.Operation]
 	// numReaders is an array of 2 atomic ints, counting numbers of readers on the left/right instance.
 	numReaders [2]*int64
 	// sideToLock is an atomic var (0 or 1) and determines which side the reader locks before it starts to read.
@@ -36,9 +55,18 @@ type LeftRightLock struct {
 
 // NewLeftRightLock creates a LeftRightLock. The two structures provided have to be equal.
 func NewLeftRightLock(left, right LeftRightStructure) *LeftRightLock {
+	return NewBoundedLeftRightLock(left, right, 0)
+}
+
+// NewBoundedLeftRightLock creates a LeftRightLock that keeps at most maxPending unpublished operations. Once that many
+// operations were written, the next Write publishes them first, so a writer that never publishes can't exhaust memory.
+// That implicit Publish breaks batch atomicity: readers see whatever part of the current batch was written so far, and
+// the results of reapplying those operations are discarded. Use TryWrite to get ErrFull instead and decide when to
+// publish. A non-positive maxPending means no limit. The two structures provided have to be equal.
+func NewBoundedLeftRightLock(left, right LeftRightStructure, maxPending int) *LeftRightLock {
 	m := &LeftRightLock{
 		data:       [2]LeftRightStructure{left, right},
-		opQ:        deque.NewDeque(),
+		opQ:        deque.NewBoundedDeque[deque.Operation](maxPending, deque.Reject),
 		numReaders: [2]*int64{new(int64), new(int64)},
 		// Start reading on Left as this is initialized to 0
 		sideToLock: new(int32),
@@ -67,9 +95,27 @@ func (lr *LeftRightLock) Publish() []OpResult {
 	return lr.reapplyOpHistory()
 }
 
-// Write runs the Update method ont the writeable side with the given operator.
+// Write runs the Update method ont the writeable side with the given operator. If the lock is bounded and already holds
+// the maximum number of unpublished operations, it publishes them first, discarding the results of that Publish.
 func (lr *LeftRightLock) Write(op Operation) OpResult {
-	lr.opQ.PushBack(op)
+	if err := lr.opQ.PushBack(op); err != nil {
+		lr.Publish()
+		lr.opQ.PushBack(op)
+	}
+	return lr.apply(op)
+}
+
+// TryWrite is like Write, but never publishes. If the lock is bounded and already holds the maximum number of
+// unpublished operations, it leaves both sides unchanged and returns ErrFull, so the caller can Publish and retry.
+func (lr *LeftRightLock) TryWrite(op Operation) (OpResult, error) {
+	if err := lr.opQ.PushBack(op); err != nil {
+		return nil, ErrFull
+	}
+	return lr.apply(op), nil
+}
+
+// apply runs the Update method on the writeable side.
+func (lr *LeftRightLock) apply(op Operation) OpResult {
 	sideToWrite := 1 - atomic.LoadInt32(lr.sideToRead)
 	return lr.data[sideToWrite].Update(op)
 }
@@ -101,9 +147,8 @@ func (lr *LeftRightLock) swap() (newSideToWrite int32) {
 // result.
 func (lr *LeftRightLock) reapplyOpHistory() (results []OpResult) {
 	sideToWrite := 1 - atomic.LoadInt32(lr.sideToRead)
-	for lr.opQ.Len() > 0 {
-		op, _ := lr.opQ.PopFront()
+	lr.opQ.DrainTo(func(op deque.Operation) {
 		results = append(results, lr.data[sideToWrite].Update(op))
-	}
+	})
 	return
 }
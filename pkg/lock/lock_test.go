@@ -126,3 +126,66 @@ func TestRaceConditionWait(t *testing.T) {
 	wg.Wait()
 	assert.Equal(t, int32(1), atomic.LoadInt32(writeCompleted))
 }
+
+func TestBoundedPublishesWhenFull(t *testing.T) {
+	lock := NewBoundedLeftRightLock(newTestData(), newTestData(), 2)
+	read := func(key string) bool {
+		m, art := lock.RLock()
+		defer lock.RUnlock(art)
+		_, ok := (*m.(*testData))[key]
+		return ok
+	}
+
+	lock.Write(input{"a", "1"})
+	lock.Write(input{"b", "2"})
+	assert.False(t, read("a"))
+
+	// The third write publishes the first two.
+	lock.Write(input{"c", "3"})
+	assert.True(t, read("a"))
+	assert.True(t, read("b"))
+	assert.False(t, read("c"))
+
+	results := lock.Publish()
+	assert.Equal(t, []OpResult{"c"}, results)
+	assert.True(t, read("c"))
+	// Both sides hold all the writes.
+	lock.Publish()
+	assert.True(t, read("a"))
+	assert.True(t, read("c"))
+}
+
+func TestBoundedTryWrite(t *testing.T) {
+	lock := NewBoundedLeftRightLock(newTestData(), newTestData(), 2)
+	read := func(key string) bool {
+		m, art := lock.RLock()
+		defer lock.RUnlock(art)
+		_, ok := (*m.(*testData))[key]
+		return ok
+	}
+
+	res, err := lock.TryWrite(input{"a", "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", res)
+	_, err = lock.TryWrite(input{"b", "2"})
+	assert.NoError(t, err)
+
+	// The third write is rejected and nothing gets published.
+	res, err = lock.TryWrite(input{"c", "3"})
+	assert.ErrorIs(t, err, ErrFull)
+	assert.Nil(t, res)
+	assert.False(t, read("a"))
+
+	assert.Equal(t, []OpResult{"a", "b"}, lock.Publish())
+	assert.True(t, read("a"))
+	assert.True(t, read("b"))
+	assert.False(t, read("c"))
+	_, err = lock.TryWrite(input{"c", "3"})
+	assert.NoError(t, err)
+	lock.Publish()
+	assert.True(t, read("c"))
+	// Both sides hold exactly the accepted writes.
+	lock.Publish()
+	assert.Len(t, *lock.data[0].(*testData), 3)
+	assert.Len(t, *lock.data[1].(*testData), 3)
+}
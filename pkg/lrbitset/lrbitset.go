@@ -0,0 +1,254 @@
+package lrbitset
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// MaxBits is the size limit of a BitSet. The bitmap is stored densely, so setting bit i allocates about i/8 bytes on
+// each side, and indices from untrusted input could otherwise exhaust memory. At the limit, each side takes 256 MiB.
+const MaxBits = 1 << 31
+
+// ErrOutOfRange is returned when writing a bit at or above MaxBits.
+var ErrOutOfRange = errors.New("lrbitset: bit index out of range")
+
+// BitSet is a growable bitmap protected by a LeftRightLock. Set, Clear, SetRange, Flip and Publish are writes, all the
+// other methods are reads.
+//
+// Along with the bits, each side keeps a Fenwick tree of per-word bit counts, so Rank and Select run in O(log n)
+// instead of scanning the whole bitmap.
+type BitSet struct {
+	lr *lock.LeftRightLock
+}
+
+// New creates an empty BitSet.
+func New() *BitSet {
+	return &BitSet{lr: lock.NewLeftRightLock(&bitmap{}, &bitmap{})}
+}
+
+// Set sets bit i. Returns true if it was not set before, or ErrOutOfRange if i is not below MaxBits.
+func (b *BitSet) Set(i uint) (bool, error) {
+	if i >= MaxBits {
+		return false, ErrOutOfRange
+	}
+	return b.lr.Write(setOp{i}).(bool), nil
+}
+
+// Clear clears bit i. Returns true if it was set before.
+func (b *BitSet) Clear(i uint) bool {
+	return b.lr.Write(clearOp{i}).(bool)
+}
+
+// Flip toggles bit i and returns its new value, or ErrOutOfRange if i is not below MaxBits.
+func (b *BitSet) Flip(i uint) (bool, error) {
+	if i >= MaxBits {
+		return false, ErrOutOfRange
+	}
+	return b.lr.Write(flipOp{i}).(bool), nil
+}
+
+// SetRange sets all bits in [lo, hi) and returns how many of them were not set before, or ErrOutOfRange if hi is above
+// MaxBits.
+func (b *BitSet) SetRange(lo, hi uint) (uint, error) {
+	if hi > MaxBits {
+		return 0, ErrOutOfRange
+	}
+	return b.lr.Write(setRangeOp{lo, hi}).(uint), nil
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (b *BitSet) Publish() {
+	b.lr.Publish()
+}
+
+// Test returns true if bit i is set.
+func (b *BitSet) Test(i uint) bool {
+	data, art := b.lr.RLock()
+	defer b.lr.RUnlock(art)
+	return data.(*bitmap).test(i)
+}
+
+// Count returns the number of set bits.
+func (b *BitSet) Count() uint {
+	data, art := b.lr.RLock()
+	defer b.lr.RUnlock(art)
+	return data.(*bitmap).count
+}
+
+// Rank returns the number of set bits in [0, i).
+func (b *BitSet) Rank(i uint) uint {
+	data, art := b.lr.RLock()
+	defer b.lr.RUnlock(art)
+	return data.(*bitmap).rank(i)
+}
+
+// Select returns the index of the k-th set bit, counting from zero. Returns false if there are at most k set bits.
+func (b *BitSet) Select(k uint) (uint, bool) {
+	data, art := b.lr.RLock()
+	defer b.lr.RUnlock(art)
+	return data.(*bitmap).selectBit(k)
+}
+
+// NextSet returns the index of the first set bit at or after i. Returns false if there is none.
+func (b *BitSet) NextSet(i uint) (uint, bool) {
+	data, art := b.lr.RLock()
+	defer b.lr.RUnlock(art)
+	return data.(*bitmap).nextSet(i)
+}
+
+// bitmap is one copy of the bits.
+type bitmap struct {
+	words []uint64
+	// tree is a Fenwick tree over the bit counts of words. It is one-indexed, so tree[0] is unused.
+	tree  []uint
+	count uint
+}
+
+// grow makes sure word w exists, at least doubling the number of words so growing is amortized.
+func (m *bitmap) grow(w uint) {
+	if w < uint(len(m.words)) {
+		return
+	}
+	n := 2 * uint(len(m.words))
+	if n <= w {
+		n = w + 1
+	}
+	words := make([]uint64, n)
+	copy(words, m.words)
+	m.words = words
+	// Rebuild the tree from scratch in O(n).
+	m.tree = make([]uint, n+1)
+	for i, word := range m.words {
+		m.tree[i+1] += uint(bits.OnesCount64(word))
+		if p := i + 1 + (i+1)&-(i+1); p <= len(m.words) {
+			m.tree[p] += m.tree[i+1]
+		}
+	}
+}
+
+// setWord replaces word w and keeps the counts up to date.
+func (m *bitmap) setWord(w uint, word uint64) {
+	before := bits.OnesCount64(m.words[w])
+	after := bits.OnesCount64(word)
+	m.words[w] = word
+	if before == after {
+		return
+	}
+	for i := w + 1; i < uint(len(m.tree)); i += i & -i {
+		// Adding the two's complement of the difference works for negative differences as well.
+		m.tree[i] += uint(after - before)
+	}
+	m.count += uint(after - before)
+}
+
+func (m *bitmap) test(i uint) bool {
+	w := i / 64
+	return w < uint(len(m.words)) && m.words[w]&(1<<(i%64)) != 0
+}
+
+// rank returns the number of set bits in [0, i).
+func (m *bitmap) rank(i uint) uint {
+	w := i / 64
+	if w >= uint(len(m.words)) {
+		return m.count
+	}
+	var res uint
+	for j := w; j > 0; j -= j & -j {
+		res += m.tree[j]
+	}
+	return res + uint(bits.OnesCount64(m.words[w]&(1<<(i%64)-1)))
+}
+
+func (m *bitmap) selectBit(k uint) (uint, bool) {
+	if k >= m.count {
+		return 0, false
+	}
+	// Descend the Fenwick tree to find the word containing the k-th set bit.
+	var w uint
+	for step := uint(1) << (bits.Len(uint(len(m.words))) - 1); step > 0; step >>= 1 {
+		if w+step < uint(len(m.tree)) && m.tree[w+step] <= k {
+			w += step
+			k -= m.tree[w]
+		}
+	}
+	// Drop the k lowest set bits of the word, the lowest remaining one is the one we're looking for.
+	word := m.words[w]
+	for ; k > 0; k-- {
+		word &= word - 1
+	}
+	return w*64 + uint(bits.TrailingZeros64(word)), true
+}
+
+func (m *bitmap) nextSet(i uint) (uint, bool) {
+	w := i / 64
+	if w >= uint(len(m.words)) {
+		return 0, false
+	}
+	word := m.words[w] >> (i % 64)
+	if word != 0 {
+		return i + uint(bits.TrailingZeros64(word)), true
+	}
+	for w++; w < uint(len(m.words)); w++ {
+		if m.words[w] != 0 {
+			return w*64 + uint(bits.TrailingZeros64(m.words[w])), true
+		}
+	}
+	return 0, false
+}
+
+type setOp struct {
+	i uint
+}
+
+type clearOp struct {
+	i uint
+}
+
+type flipOp struct {
+	i uint
+}
+
+type setRangeOp struct {
+	lo, hi uint
+}
+
+// Update applies a single bitmap operation.
+func (m *bitmap) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case setOp:
+		was := m.test(o.i)
+		m.grow(o.i / 64)
+		m.setWord(o.i/64, m.words[o.i/64]|1<<(o.i%64))
+		return !was
+	case clearOp:
+		if !m.test(o.i) {
+			return false
+		}
+		m.setWord(o.i/64, m.words[o.i/64]&^(1<<(o.i%64)))
+		return true
+	case flipOp:
+		m.grow(o.i / 64)
+		m.setWord(o.i/64, m.words[o.i/64]^1<<(o.i%64))
+		return m.test(o.i)
+	case setRangeOp:
+		if o.lo >= o.hi {
+			return uint(0)
+		}
+		before := m.count
+		m.grow((o.hi - 1) / 64)
+		for w := o.lo / 64; w <= (o.hi-1)/64; w++ {
+			mask := ^uint64(0)
+			if w == o.lo/64 {
+				mask &= ^uint64(0) << (o.lo % 64)
+			}
+			if w == (o.hi-1)/64 && o.hi%64 != 0 {
+				mask &= 1<<(o.hi%64) - 1
+			}
+			m.setWord(w, m.words[w]|mask)
+		}
+		return m.count - before
+	}
+	panic("lrbitset: unknown operation")
+}
@@ -0,0 +1,177 @@
+package lrbitset
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+// must returns the value of a write that is expected to succeed.
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestOutOfRange(t *testing.T) {
+	b := New()
+	_, err := b.Set(math.MaxUint)
+	assert.ErrorIs(t, err, ErrOutOfRange)
+	_, err = b.Set(MaxBits)
+	assert.ErrorIs(t, err, ErrOutOfRange)
+	_, err = b.Flip(MaxBits)
+	assert.ErrorIs(t, err, ErrOutOfRange)
+	_, err = b.SetRange(0, MaxBits+1)
+	assert.ErrorIs(t, err, ErrOutOfRange)
+
+	// Rejected writes never reach the lock, so they don't break the next Publish.
+	b.Publish()
+	assert.Equal(t, uint(0), b.Count())
+	assert.True(t, must(b.Set(1000)))
+	b.Publish()
+	assert.True(t, b.Test(1000))
+}
+
+func TestBasic(t *testing.T) {
+	b := New()
+	assert.True(t, must(b.Set(3)))
+	assert.False(t, must(b.Set(3)))
+	assert.True(t, must(b.Set(1000)))
+	assert.False(t, b.Test(3))
+
+	b.Publish()
+	assert.True(t, b.Test(3))
+	assert.True(t, b.Test(1000))
+	assert.False(t, b.Test(4))
+	assert.False(t, b.Test(1<<40))
+	assert.Equal(t, uint(2), b.Count())
+
+	assert.True(t, b.Clear(3))
+	assert.False(t, b.Clear(3))
+	assert.False(t, b.Clear(1<<40))
+	assert.True(t, must(b.Flip(5)))
+	assert.False(t, must(b.Flip(1000)))
+	b.Publish()
+	assert.False(t, b.Test(3))
+	assert.True(t, b.Test(5))
+	assert.False(t, b.Test(1000))
+	assert.Equal(t, uint(1), b.Count())
+}
+
+func TestSetRange(t *testing.T) {
+	b := New()
+	b.Set(70)
+	assert.Equal(t, uint(0), must(b.SetRange(10, 10)))
+	assert.Equal(t, uint(189), must(b.SetRange(10, 200)))
+	b.Publish()
+	assert.Equal(t, uint(190), b.Count())
+	assert.False(t, b.Test(9))
+	assert.True(t, b.Test(10))
+	assert.True(t, b.Test(199))
+	assert.False(t, b.Test(200))
+
+	assert.Equal(t, uint(64), must(b.SetRange(256, 320)))
+	b.Publish()
+	assert.False(t, b.Test(255))
+	assert.True(t, b.Test(256))
+	assert.True(t, b.Test(319))
+	assert.False(t, b.Test(320))
+}
+
+func TestRankSelectNext(t *testing.T) {
+	b := New()
+	for _, i := range []uint{0, 5, 63, 64, 200, 1000} {
+		b.Set(i)
+	}
+	b.Publish()
+
+	assert.Equal(t, uint(0), b.Rank(0))
+	assert.Equal(t, uint(1), b.Rank(1))
+	assert.Equal(t, uint(3), b.Rank(64))
+	assert.Equal(t, uint(4), b.Rank(65))
+	assert.Equal(t, uint(6), b.Rank(1001))
+	assert.Equal(t, uint(6), b.Rank(1<<40))
+
+	for k, want := range []uint{0, 5, 63, 64, 200, 1000} {
+		got, ok := b.Select(uint(k))
+		assert.True(t, ok)
+		assert.Equal(t, want, got)
+	}
+	_, ok := b.Select(6)
+	assert.False(t, ok)
+
+	next, ok := b.NextSet(6)
+	assert.True(t, ok)
+	assert.Equal(t, uint(63), next)
+	next, ok = b.NextSet(65)
+	assert.True(t, ok)
+	assert.Equal(t, uint(200), next)
+	next, ok = b.NextSet(200)
+	assert.True(t, ok)
+	assert.Equal(t, uint(200), next)
+	_, ok = b.NextSet(1001)
+	assert.False(t, ok)
+}
+
+func TestRandomAgainstNaive(t *testing.T) {
+	b := New()
+	ref := make([]bool, 5000)
+	for i := 0; i < 5000; i++ {
+		j := uint(rand.Intn(len(ref)))
+		switch rand.Intn(4) {
+		case 0:
+			b.Set(j)
+			ref[j] = true
+		case 1:
+			b.Clear(j)
+			ref[j] = false
+		case 2:
+			b.Flip(j)
+			ref[j] = !ref[j]
+		default:
+			hi := j + uint(rand.Intn(100))
+			if hi > uint(len(ref)) {
+				hi = uint(len(ref))
+			}
+			b.SetRange(j, hi)
+			for k := j; k < hi; k++ {
+				ref[k] = true
+			}
+		}
+		if i%100 == 0 {
+			b.Publish()
+		}
+	}
+	// Check both sides.
+	for s := 0; s < 2; s++ {
+		b.Publish()
+		var rank uint
+		for i, set := range ref {
+			assert.Equal(t, set, b.Test(uint(i)))
+			assert.Equal(t, rank, b.Rank(uint(i)))
+			if set {
+				sel, ok := b.Select(rank)
+				assert.True(t, ok)
+				assert.Equal(t, uint(i), sel)
+				rank++
+			}
+		}
+		assert.Equal(t, rank, b.Count())
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	b := New()
+	lrtest.ConcurrentReaders(1000, func(int) {
+		// Bits are only ever set in pairs.
+		assert.Equal(t, uint(0), b.Count()%2)
+	}, func(i int) {
+		b.SetRange(2*uint(i), 2*uint(i)+2)
+		b.Publish()
+	})
+}
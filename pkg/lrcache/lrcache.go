@@ -0,0 +1,289 @@
+package lrcache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// Options configure a Cache. The zero value is a valid configuration of an unbounded cache with no expiry.
+type Options struct {
+	// MaxEntries is the maximum number of entries kept in the cache. Least recently used entries are evicted once this
+	// is exceeded. Zero means no limit.
+	MaxEntries int
+	// TTL is the time an entry stays in the cache after it was last Set. Zero means entries never expire.
+	TTL time.Duration
+	// HintBufferSize is the number of access hints each Reader can buffer between two drains by the writer. Hints that
+	// don't fit are dropped, so readers never wait. Defaults to 64 and is rounded up to a power of two.
+	HintBufferSize int
+	// Now returns the current time. Defaults to time.Now and is only overridden in tests.
+	Now func() time.Time
+}
+
+// Cache is a read-mostly LRU/TTL cache from K to V, protected by a LeftRightLock. Set, Delete and Publish are writes.
+// Reads are done through Readers, each of which must only be used by a single go routine.
+//
+// Readers can't mutate the shared structure, so instead of updating recency on every Get they record access hints into
+// their own buffers. The writer drains those buffers, maintains LRU and expiry order on its side only, and evicts
+// entries by writing delete operations, so that both sides evict identically.
+type Cache[K comparable, V any] struct {
+	lr   *lock.LeftRightLock
+	opts Options
+	// entries, lru and byAge are the writer-side bookkeeping. Readers never touch them.
+	entries map[K]*meta[K]
+	// lru holds entries from the most (front) to the least (back) recently used.
+	lru *list.List
+	// byAge holds entries in the order they were last Set, which is also the order they expire in.
+	byAge *list.List
+	// readers is an atomic.Value holding []*Reader, so the writer can drain hints without taking mu.
+	readers atomic.Value
+	// mu guards registration and removal of readers.
+	mu sync.Mutex
+}
+
+// meta is the writer-side bookkeeping for a single cached entry.
+type meta[K comparable] struct {
+	key     K
+	expires int64
+	lruElem *list.Element
+	ageElem *list.Element
+}
+
+// New creates an empty Cache with the given options.
+func New[K comparable, V any](opts Options) *Cache[K, V] {
+	if opts.HintBufferSize <= 0 {
+		opts.HintBufferSize = 64
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	c := &Cache[K, V]{
+		lr:      lock.NewLeftRightLock(newStore[K, V](), newStore[K, V]()),
+		opts:    opts,
+		entries: make(map[K]*meta[K]),
+		lru:     list.New(),
+		byAge:   list.New(),
+	}
+	c.readers.Store([]*Reader[K, V](nil))
+	return c
+}
+
+// Set inserts or replaces the value for key and marks it as most recently used. If the cache grows over MaxEntries,
+// the least recently used entries are evicted.
+func (c *Cache[K, V]) Set(key K, value V) {
+	var expires int64
+	if c.opts.TTL > 0 {
+		expires = c.opts.Now().Add(c.opts.TTL).UnixNano()
+	}
+	if m, ok := c.entries[key]; ok {
+		m.expires = expires
+		c.lru.MoveToFront(m.lruElem)
+		c.byAge.MoveToBack(m.ageElem)
+	} else {
+		m = &meta[K]{key: key, expires: expires}
+		m.lruElem = c.lru.PushFront(m)
+		m.ageElem = c.byAge.PushBack(m)
+		c.entries[key] = m
+	}
+	c.lr.Write(setOp[K, V]{key, entry[V]{value, expires}})
+	c.evictOverflow()
+}
+
+// Delete removes key from the cache. Returns true if it was present.
+func (c *Cache[K, V]) Delete(key K) bool {
+	m, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	c.remove(m)
+	return true
+}
+
+// Len returns the number of entries on the writer side, including unpublished ones.
+func (c *Cache[K, V]) Len() int {
+	return len(c.entries)
+}
+
+// Publish drains reader access hints, evicts expired and overflowing entries and makes all the changes since the last
+// Publish visible to readers.
+func (c *Cache[K, V]) Publish() {
+	c.drainHints()
+	c.expire()
+	c.evictOverflow()
+	c.lr.Publish()
+}
+
+// NewReader registers a new Reader. Each go routine that reads from the cache should have its own Reader.
+func (c *Cache[K, V]) NewReader() *Reader[K, V] {
+	size := 1
+	for size < c.opts.HintBufferSize {
+		size <<= 1
+	}
+	r := &Reader[K, V]{
+		c:     c,
+		hints: make([]K, size),
+		mask:  uint64(size - 1),
+		head:  new(uint64),
+		tail:  new(uint64),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.readers.Load().([]*Reader[K, V])
+	readers := make([]*Reader[K, V], len(old), len(old)+1)
+	copy(readers, old)
+	c.readers.Store(append(readers, r))
+	return r
+}
+
+// drainHints moves every entry a reader accessed since the last drain to the front of the LRU list.
+func (c *Cache[K, V]) drainHints() {
+	for _, r := range c.readers.Load().([]*Reader[K, V]) {
+		r.drain(func(key K) {
+			if m, ok := c.entries[key]; ok {
+				c.lru.MoveToFront(m.lruElem)
+			}
+		})
+	}
+}
+
+// expire removes all entries that outlived their TTL.
+func (c *Cache[K, V]) expire() {
+	if c.opts.TTL <= 0 {
+		return
+	}
+	now := c.opts.Now().UnixNano()
+	for e := c.byAge.Front(); e != nil; e = c.byAge.Front() {
+		m := e.Value.(*meta[K])
+		if m.expires > now {
+			return
+		}
+		c.remove(m)
+	}
+}
+
+// evictOverflow removes least recently used entries until the cache fits into MaxEntries.
+func (c *Cache[K, V]) evictOverflow() {
+	if c.opts.MaxEntries <= 0 || len(c.entries) <= c.opts.MaxEntries {
+		return
+	}
+	// Take readers' hints into account before deciding what was used least recently.
+	c.drainHints()
+	for len(c.entries) > c.opts.MaxEntries {
+		c.remove(c.lru.Back().Value.(*meta[K]))
+	}
+}
+
+// remove drops the entry from writer-side bookkeeping and writes a delete operation so both sides drop it as well.
+func (c *Cache[K, V]) remove(m *meta[K]) {
+	c.lru.Remove(m.lruElem)
+	c.byAge.Remove(m.ageElem)
+	delete(c.entries, m.key)
+	c.lr.Write(deleteOp[K]{m.key})
+}
+
+// Reader reads from a Cache. It must only be used by a single go routine.
+type Reader[K comparable, V any] struct {
+	c *Cache[K, V]
+	// hints is a single-producer single-consumer ring buffer of accessed keys. The reader pushes at tail and the writer
+	// pops at head.
+	hints []K
+	mask  uint64
+	head  *uint64
+	tail  *uint64
+}
+
+// Get returns the value stored for key. This is a wait-free operation.
+func (r *Reader[K, V]) Get(key K) (V, bool) {
+	data, art := r.c.lr.RLock()
+	e, ok := (*data.(*store[K, V]))[key]
+	r.c.lr.RUnlock(art)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	// The writer might not have published the expiry yet, so check it on the reader side as well.
+	if e.expires != 0 && e.expires <= r.c.opts.Now().UnixNano() {
+		var zero V
+		return zero, false
+	}
+	r.hint(key)
+	return e.value, true
+}
+
+// Close unregisters the reader. It must not be used afterwards.
+func (r *Reader[K, V]) Close() {
+	c := r.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.readers.Load().([]*Reader[K, V])
+	readers := make([]*Reader[K, V], 0, len(old))
+	for _, o := range old {
+		if o != r {
+			readers = append(readers, o)
+		}
+	}
+	c.readers.Store(readers)
+}
+
+// hint records an access to key, or drops it if the buffer is full.
+func (r *Reader[K, V]) hint(key K) {
+	tail := atomic.LoadUint64(r.tail)
+	if tail-atomic.LoadUint64(r.head) > r.mask {
+		return
+	}
+	r.hints[tail&r.mask] = key
+	atomic.StoreUint64(r.tail, tail+1)
+}
+
+// drain calls fn with all hints recorded so far. It must only be called by the writer.
+func (r *Reader[K, V]) drain(fn func(K)) {
+	head := atomic.LoadUint64(r.head)
+	tail := atomic.LoadUint64(r.tail)
+	for ; head < tail; head++ {
+		fn(r.hints[head&r.mask])
+		// Don't hold on to the key, so it can be garbage collected once it's evicted.
+		var zero K
+		r.hints[head&r.mask] = zero
+	}
+	atomic.StoreUint64(r.head, head)
+}
+
+// entry is a single cached value along with its expiry time in unix nanoseconds (zero for no expiry).
+type entry[V any] struct {
+	value   V
+	expires int64
+}
+
+// store maps keys to their entries on one side of the lock.
+type store[K comparable, V any] map[K]entry[V]
+
+func newStore[K comparable, V any]() *store[K, V] {
+	s := make(store[K, V])
+	return &s
+}
+
+type setOp[K comparable, V any] struct {
+	key   K
+	entry entry[V]
+}
+
+type deleteOp[K comparable] struct {
+	key K
+}
+
+// Update applies a single cache operation.
+func (s *store[K, V]) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case setOp[K, V]:
+		(*s)[o.key] = o.entry
+		return nil
+	case deleteOp[K]:
+		_, ok := (*s)[o.key]
+		delete(*s, o.key)
+		return ok
+	}
+	panic("lrcache: unknown operation")
+}
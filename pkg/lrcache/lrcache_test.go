@@ -0,0 +1,167 @@
+package lrcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestBasic(t *testing.T) {
+	c := New[string, int](Options{})
+	r := c.NewReader()
+	defer r.Close()
+
+	c.Set("a", 1)
+	_, ok := r.Get("a")
+	assert.False(t, ok)
+
+	c.Publish()
+	v, ok := r.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	c.Publish()
+	_, ok = r.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := New[string, int](Options{MaxEntries: 3})
+	r := c.NewReader()
+	defer r.Close()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Publish()
+
+	// Reading "a" makes it more recently used than "b", even though it was written first.
+	_, ok := r.Get("a")
+	assert.True(t, ok)
+
+	c.Set("d", 4)
+	c.Publish()
+	assert.Equal(t, 3, c.Len())
+
+	_, ok = r.Get("b")
+	assert.False(t, ok)
+	for _, key := range []string{"a", "c", "d"} {
+		_, ok = r.Get(key)
+		assert.True(t, ok, key)
+	}
+
+	// Both sides must have evicted the same entry.
+	c.Publish()
+	_, ok = r.Get("b")
+	assert.False(t, ok)
+	_, ok = r.Get("a")
+	assert.True(t, ok)
+}
+
+func TestTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c := New[string, int](Options{TTL: time.Minute, Now: clock.Now})
+	r := c.NewReader()
+	defer r.Close()
+
+	c.Set("a", 1)
+	clock.Advance(30 * time.Second)
+	c.Set("b", 2)
+	c.Publish()
+
+	clock.Advance(45 * time.Second)
+	// "a" is expired, but not yet evicted. Readers must not see it anyway.
+	_, ok := r.Get("a")
+	assert.False(t, ok)
+	_, ok = r.Get("b")
+	assert.True(t, ok)
+
+	c.Publish()
+	assert.Equal(t, 1, c.Len())
+
+	// Setting again refreshes the TTL.
+	c.Set("b", 3)
+	clock.Advance(45 * time.Second)
+	c.Publish()
+	v, ok := r.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestHintOverflow(t *testing.T) {
+	c := New[string, int](Options{MaxEntries: 2, HintBufferSize: 2})
+	r := c.NewReader()
+	defer r.Close()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Publish()
+
+	// Only the first two hints fit into the buffer, the rest are dropped without blocking.
+	for i := 0; i < 10; i++ {
+		r.Get("b")
+	}
+	assert.Equal(t, uint64(2), *r.tail)
+
+	c.Set("c", 3)
+	c.Publish()
+	_, ok := r.Get("a")
+	assert.False(t, ok)
+	_, ok = r.Get("b")
+	assert.True(t, ok)
+}
+
+func TestReaderClose(t *testing.T) {
+	c := New[string, int](Options{})
+	r1 := c.NewReader()
+	r2 := c.NewReader()
+	assert.Len(t, c.readers.Load().([]*Reader[string, int]), 2)
+	r1.Close()
+	assert.Equal(t, []*Reader[string, int]{r2}, c.readers.Load().([]*Reader[string, int]))
+	r2.Close()
+	assert.Len(t, c.readers.Load().([]*Reader[string, int]), 0)
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	c := New[int, int](Options{MaxEntries: 10})
+	var readers [lrtest.Readers]*Reader[int, int]
+	for i := range readers {
+		readers[i] = c.NewReader()
+		defer readers[i].Close()
+	}
+	lrtest.ConcurrentReaders(1000, func(r int) {
+		for k := 0; k < 20; k++ {
+			if v, ok := readers[r].Get(k); ok {
+				assert.Equal(t, k*k, v)
+			}
+		}
+	}, func(i int) {
+		c.Set(i%20, (i%20)*(i%20))
+		c.Publish()
+	})
+	assert.Equal(t, 10, c.Len())
+}
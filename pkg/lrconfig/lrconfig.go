@@ -0,0 +1,209 @@
+package lrconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// Format is the encoding of a configuration file.
+type Format int
+
+const (
+	// Auto picks the format from the file extension: .json for JSON, and .yaml or .yml for YAML.
+	Auto Format = iota
+	JSON
+	YAML
+)
+
+// ErrUnknownFormat is returned when the format is Auto and the file extension is not recognised.
+var ErrUnknownFormat = errors.New("lrconfig: unknown config format")
+
+// Options configure a Holder.
+type Options[T any] struct {
+	// Path is the configuration file to load and watch.
+	Path string
+	// Format is the encoding of the file. Defaults to Auto.
+	Format Format
+	// Interval is how often the file is checked for changes. Defaults to one second.
+	Interval time.Duration
+	// Validate is called with every freshly decoded config before it is published. If it returns an error, the config
+	// is discarded and readers keep the previous one.
+	Validate func(*T) error
+	// OnError is called from the watcher whenever a reload fails. Optional.
+	OnError func(error)
+	// OnReload is called from the watcher after a new config was published. Optional.
+	OnReload func(*T)
+}
+
+// Holder keeps a typed configuration loaded from a file and publishes a new version whenever the file changes. Get is
+// a wait-free read that can be called from any go routine, e.g. on every request.
+//
+// Published configs are shared by all readers, so they must be treated as immutable.
+type Holder[T any] struct {
+	lr   *lock.LeftRightLock
+	opts Options[T]
+	// mu makes Reload and the watcher the single writer of lr. It also guards the fields below.
+	mu sync.Mutex
+	// modTime and size identify the version of the file that was last read, so unchanged files are not decoded again.
+	modTime time.Time
+	size    int64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New creates a Holder and loads the config for the first time. It fails if the initial load or validation fails.
+// Call Watch to start reloading on file changes.
+func New[T any](opts Options[T]) (*Holder[T], error) {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	h := &Holder[T]{
+		lr:   lock.NewLeftRightLock(&slot[T]{}, &slot[T]{}),
+		opts: opts,
+	}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Get returns the currently published config. This is a wait-free operation.
+func (h *Holder[T]) Get() *T {
+	data, art := h.lr.RLock()
+	defer h.lr.RUnlock(art)
+	return data.(*slot[T]).cfg
+}
+
+// Reload reads, decodes and validates the file and publishes the result. On error the previous config is kept.
+func (h *Holder[T]) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.reload(true)
+	return err
+}
+
+// Watch starts polling the file for changes in a separate go routine. Changes are detected by the modification time
+// and size of the file. Calling Watch on a Holder that is already watching does nothing.
+func (h *Holder[T]) Watch() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stop != nil {
+		return
+	}
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+	go h.watch(h.stop, h.done)
+}
+
+// Close stops the watcher started by Watch and waits for it to exit. The last published config stays readable.
+func (h *Holder[T]) Close() {
+	h.mu.Lock()
+	stop, done := h.stop, h.done
+	h.stop, h.done = nil, nil
+	h.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (h *Holder[T]) watch(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(h.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		h.mu.Lock()
+		reloaded, err := h.reload(false)
+		h.mu.Unlock()
+		if err != nil && h.opts.OnError != nil {
+			h.opts.OnError(err)
+		}
+		if reloaded && h.opts.OnReload != nil {
+			h.opts.OnReload(h.Get())
+		}
+	}
+}
+
+// reload loads the file if it changed since the last load, or unconditionally if force is set. Returns true if a new
+// config was published. It must be called with mu held.
+func (h *Holder[T]) reload(force bool) (bool, error) {
+	info, err := os.Stat(h.opts.Path)
+	if err != nil {
+		return false, err
+	}
+	if !force && info.ModTime().Equal(h.modTime) && info.Size() == h.size {
+		return false, nil
+	}
+	// Remember the version even if it turns out to be invalid, so we don't report the same error on every poll.
+	h.modTime, h.size = info.ModTime(), info.Size()
+
+	data, err := os.ReadFile(h.opts.Path)
+	if err != nil {
+		return false, err
+	}
+	cfg := new(T)
+	if err = h.decode(data, cfg); err != nil {
+		return false, fmt.Errorf("lrconfig: decoding %s: %w", h.opts.Path, err)
+	}
+	if h.opts.Validate != nil {
+		if err = h.opts.Validate(cfg); err != nil {
+			return false, fmt.Errorf("lrconfig: validating %s: %w", h.opts.Path, err)
+		}
+	}
+	h.lr.Write(cfg)
+	h.lr.Publish()
+	return true, nil
+}
+
+// decode unmarshals data into cfg. A panicking decoder is turned into an error, so a malformed file can't take down the
+// watcher go routine, and with it the process.
+func (h *Holder[T]) decode(data []byte, cfg *T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("decoder panicked: %v", r)
+		}
+	}()
+	format := h.opts.Format
+	if format == Auto {
+		switch filepath.Ext(h.opts.Path) {
+		case ".json":
+			format = JSON
+		case ".yaml", ".yml":
+			format = YAML
+		default:
+			return ErrUnknownFormat
+		}
+	}
+	switch format {
+	case JSON:
+		return json.Unmarshal(data, cfg)
+	case YAML:
+		return yaml.Unmarshal(data, cfg)
+	}
+	return ErrUnknownFormat
+}
+
+// slot is one side of the lock. Both sides point to the same immutable config.
+type slot[T any] struct {
+	cfg *T
+}
+
+// Update replaces the config. The operation is the new *T.
+func (s *slot[T]) Update(op lock.Operation) lock.OpResult {
+	s.cfg = op.(*T)
+	return nil
+}
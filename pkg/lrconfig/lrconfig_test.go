@@ -0,0 +1,172 @@
+package lrconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+type testConfig struct {
+	Name    string `json:"name" yaml:"name"`
+	Workers int    `json:"workers" yaml:"workers"`
+}
+
+func validate(c *testConfig) error {
+	if c.Workers <= 0 {
+		return errors.New("workers must be positive")
+	}
+	return nil
+}
+
+// writeFile writes data to path and bumps its modification time, so changes are detected even on file systems with a
+// coarse timestamp resolution.
+func writeFile(t *testing.T, path, data string) {
+	assert.Nil(t, os.WriteFile(path, []byte(data), 0o644))
+	mtime := time.Now().Add(time.Duration(len(data)) * time.Second)
+	assert.Nil(t, os.Chtimes(path, mtime, mtime))
+}
+
+func TestLoadJSONAndYAML(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "config.json")
+	writeFile(t, jsonPath, `{"name": "json", "workers": 2}`)
+	h, err := New(Options[testConfig]{Path: jsonPath, Validate: validate})
+	assert.Nil(t, err)
+	assert.Equal(t, &testConfig{"json", 2}, h.Get())
+
+	yamlPath := filepath.Join(dir, "config.yml")
+	writeFile(t, yamlPath, "name: yaml\nworkers: 3\n")
+	hy, err := New(Options[testConfig]{Path: yamlPath})
+	assert.Nil(t, err)
+	assert.Equal(t, &testConfig{"yaml", 3}, hy.Get())
+
+	// Explicit format overrides the extension.
+	txtPath := filepath.Join(dir, "config.txt")
+	writeFile(t, txtPath, "name: txt\nworkers: 1\n")
+	_, err = New(Options[testConfig]{Path: txtPath})
+	assert.True(t, errors.Is(err, ErrUnknownFormat))
+	ht, err := New(Options[testConfig]{Path: txtPath, Format: YAML})
+	assert.Nil(t, err)
+	assert.Equal(t, "txt", ht.Get().Name)
+}
+
+func TestInitialErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := New(Options[testConfig]{Path: filepath.Join(dir, "missing.json")})
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	path := filepath.Join(dir, "config.json")
+	writeFile(t, path, `{"workers": 0}`)
+	_, err = New(Options[testConfig]{Path: path, Validate: validate})
+	assert.NotNil(t, err)
+
+	writeFile(t, path, `{"workers": `)
+	_, err = New(Options[testConfig]{Path: path})
+	assert.NotNil(t, err)
+}
+
+func TestReloadKeepsOldConfigOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeFile(t, path, `{"name": "v1", "workers": 1}`)
+	h, err := New(Options[testConfig]{Path: path, Validate: validate})
+	assert.Nil(t, err)
+	old := h.Get()
+
+	writeFile(t, path, `{"name": "v2", "workers": -1}`)
+	assert.NotNil(t, h.Reload())
+	assert.Same(t, old, h.Get())
+
+	writeFile(t, path, `not json`)
+	assert.NotNil(t, h.Reload())
+	assert.Same(t, old, h.Get())
+
+	writeFile(t, path, `{"name": "v3", "workers": 3}`)
+	assert.Nil(t, h.Reload())
+	assert.Equal(t, &testConfig{"v3", 3}, h.Get())
+}
+
+// panicky panics while being decoded, standing in for decoder bugs triggered by malformed input.
+type panicky struct{}
+
+func (panicky) UnmarshalYAML(*yaml.Node) error {
+	panic("internal error")
+}
+
+func TestMalformedYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "name: v1\nworkers: 1\n")
+	h, err := New(Options[testConfig]{Path: path, Validate: validate})
+	assert.Nil(t, err)
+	old := h.Get()
+
+	// This input used to make the decoder panic (CVE-2022-28948).
+	writeFile(t, path, "0: [:!00 \xef")
+	assert.NotNil(t, h.Reload())
+	assert.Same(t, old, h.Get())
+
+	// Any decoder panic is reported as a reload error instead.
+	writeFile(t, path, "name: v2\n")
+	hp, err := New(Options[panicky]{Path: path})
+	assert.Nil(t, hp)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "decoder panicked")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeFile(t, path, `{"name": "v1", "workers": 1}`)
+
+	reloads := make(chan *testConfig, 10)
+	errs := make(chan error, 10)
+	h, err := New(Options[testConfig]{
+		Path:     path,
+		Interval: time.Millisecond,
+		Validate: validate,
+		OnReload: func(c *testConfig) { reloads <- c },
+		OnError:  func(err error) { errs <- err },
+	})
+	assert.Nil(t, err)
+	h.Watch()
+	h.Watch()
+	defer h.Close()
+
+	writeFile(t, path, `{"name": "v2", "workers": 2}`)
+	assert.Equal(t, &testConfig{"v2", 2}, <-reloads)
+	assert.Equal(t, "v2", h.Get().Name)
+
+	writeFile(t, path, `{"name": "v3", "workers": 0}`)
+	assert.NotNil(t, <-errs)
+	assert.Equal(t, "v2", h.Get().Name)
+
+	// The invalid version is reported only once.
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, errs, 0)
+
+	h.Close()
+	writeFile(t, path, `{"name": "v4", "workers": 4}`)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, reloads, 0)
+	assert.Equal(t, "v2", h.Get().Name)
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeFile(t, path, `{"name": "v", "workers": 1}`)
+	h, err := New(Options[testConfig]{Path: path, Validate: validate})
+	assert.Nil(t, err)
+
+	lrtest.ConcurrentReaders(50, func(int) {
+		assert.Positive(t, h.Get().Workers)
+	}, func(i int) {
+		writeFile(t, path, `{"name": "v", "workers": `+string(rune('0'+i%10))+`}`)
+		h.Reload()
+	})
+}
@@ -0,0 +1,471 @@
+package lrdoc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+var (
+	// ErrInvalidPath is returned for paths that are not valid JSON Pointers (RFC 6901).
+	ErrInvalidPath = errors.New("lrdoc: invalid path")
+	// ErrNotFound is returned when a path doesn't point to an existing value, or its parent doesn't exist.
+	ErrNotFound = errors.New("lrdoc: path not found")
+	// ErrInvalidPatch is returned for malformed JSON Patch operations.
+	ErrInvalidPatch = errors.New("lrdoc: invalid patch")
+	// ErrTestFailed is returned when a JSON Patch "test" operation doesn't match.
+	ErrTestFailed = errors.New("lrdoc: test operation failed")
+)
+
+// PatchOp is a single JSON Patch (RFC 6902) operation. A patch document can be decoded straight into []PatchOp.
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// Doc is a JSON document protected by a LeftRightLock. Set, Delete, Merge, ApplyPatch and Publish are writes, while
+// Get and MarshalJSON are reads.
+//
+// The document is a tree of map[string]interface{}, []interface{} and JSON scalars (float64, string, bool and nil).
+// Values are addressed with JSON Pointers (RFC 6901), e.g. "/servers/0/host", and "" addresses the whole document.
+// Every side keeps its own copy of every value, so values passed in by the caller are never shared or modified.
+type Doc struct {
+	lr *lock.LeftRightLock
+}
+
+// New creates a Doc holding an empty object.
+func New() *Doc {
+	return &Doc{lr: lock.NewLeftRightLock(newTree(), newTree())}
+}
+
+// Set sets the value at path. Objects get a new or replaced member. Arrays get the element at the given index
+// replaced, or a new element appended if the index is "-" or the length of the array. The parent of path has to exist.
+func (d *Doc) Set(path string, value interface{}) error {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	v, err := normalize(value)
+	if err != nil {
+		return err
+	}
+	return d.write(setOp{tokens, v})
+}
+
+// Delete removes the value at path. Array elements after it are shifted down.
+func (d *Doc) Delete(path string) error {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("%w: cannot delete the whole document", ErrInvalidPath)
+	}
+	return d.write(deleteOp{tokens})
+}
+
+// Merge applies a JSON Merge Patch (RFC 7386) to the value at path. If there is no value at path, the patch is merged
+// into null and set there, so the parent of path has to exist.
+func (d *Doc) Merge(path string, patch interface{}) error {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	p, err := normalize(patch)
+	if err != nil {
+		return err
+	}
+	return d.write(mergeOp{tokens, p})
+}
+
+// ApplyPatch applies a JSON Patch (RFC 6902). The patch is applied atomically, so if any operation fails, the
+// document is left unchanged.
+func (d *Doc) ApplyPatch(patch []PatchOp) error {
+	ops := make([]patchStep, len(patch))
+	for i, p := range patch {
+		var err error
+		if ops[i], err = newPatchStep(p); err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return d.write(patchOp{ops})
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (d *Doc) Publish() {
+	d.lr.Publish()
+}
+
+// Get returns a copy of the value at path.
+func (d *Doc) Get(path string) (interface{}, error) {
+	tokens, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	data, art := d.lr.RLock()
+	defer d.lr.RUnlock(art)
+	v, err := get(data.(*tree).root, tokens)
+	if err != nil {
+		return nil, err
+	}
+	return deepCopy(v), nil
+}
+
+// MarshalJSON encodes the whole published document as JSON.
+func (d *Doc) MarshalJSON() ([]byte, error) {
+	data, art := d.lr.RLock()
+	defer d.lr.RUnlock(art)
+	return json.Marshal(data.(*tree).root)
+}
+
+// write applies op and returns the error it produced, if any.
+func (d *Doc) write(op lock.Operation) error {
+	err, _ := d.lr.Write(op).(error)
+	return err
+}
+
+// unescaper decodes "~1" and "~0" in JSON Pointer reference tokens.
+var unescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parsePath splits a JSON Pointer into unescaped reference tokens.
+func parsePath(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if path[0] != '/' {
+		return nil, fmt.Errorf("%w: %q does not start with /", ErrInvalidPath, path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = unescaper.Replace(t)
+	}
+	return tokens, nil
+}
+
+// normalize converts any value that can be encoded as JSON into the generic representation used by the document.
+func normalize(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	err = json.Unmarshal(b, &res)
+	return res, err
+}
+
+// deepCopy copies a normalized value, so the copy doesn't share any maps or slices with the original.
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[k] = deepCopy(e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = deepCopy(e)
+		}
+		return res
+	}
+	return v
+}
+
+// arrayIndex parses an array index token. If allowEnd is true, "-" and the length of the array are accepted as well
+// and refer to the position after the last element.
+func arrayIndex(arr []interface{}, token string, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return len(arr), nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrInvalidPath, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i > len(arr) || (i == len(arr) && !allowEnd) {
+		return 0, fmt.Errorf("%w: index %s out of range", ErrNotFound, token)
+	}
+	return i, nil
+}
+
+// get returns the value at the given tokens.
+func get(node interface{}, tokens []string) (interface{}, error) {
+	for _, t := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[t]
+			if !ok {
+				return nil, fmt.Errorf("%w: no member %q", ErrNotFound, t)
+			}
+			node = v
+		case []interface{}:
+			i, err := arrayIndex(n, t, false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("%w: cannot descend into a scalar at %q", ErrNotFound, t)
+		}
+	}
+	return node, nil
+}
+
+// modify walks to the parent of the value at tokens and replaces the parent with whatever fn returns. It returns the
+// new node, since modifying an array may reallocate it. It must not be called with empty tokens.
+func modify(node interface{}, tokens []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	child, err := get(node, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = modify(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		n[tokens[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(n, tokens[0], false)
+		n[i] = child
+	}
+	return node, nil
+}
+
+// put is used by modify to set a member of an object or an element of an array. If insert is true, array elements
+// at and after the index are shifted up, otherwise the element at the index is replaced.
+func put(parent interface{}, key string, value interface{}, insert bool) (interface{}, error) {
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[key] = value
+		return p, nil
+	case []interface{}:
+		i, err := arrayIndex(p, key, true)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(p) {
+			return append(p, value), nil
+		}
+		if !insert {
+			p[i] = value
+			return p, nil
+		}
+		p = append(p, nil)
+		copy(p[i+1:], p[i:])
+		p[i] = value
+		return p, nil
+	}
+	return nil, fmt.Errorf("%w: parent of %q is a scalar", ErrNotFound, key)
+}
+
+// remove is used by modify to delete a member of an object or an element of an array.
+func remove(parent interface{}, key string) (interface{}, error) {
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := p[key]; !ok {
+			return nil, fmt.Errorf("%w: no member %q", ErrNotFound, key)
+		}
+		delete(p, key)
+		return p, nil
+	case []interface{}:
+		i, err := arrayIndex(p, key, false)
+		if err != nil {
+			return nil, err
+		}
+		copy(p[i:], p[i+1:])
+		p[len(p)-1] = nil
+		return p[:len(p)-1], nil
+	}
+	return nil, fmt.Errorf("%w: parent of %q is a scalar", ErrNotFound, key)
+}
+
+// mergePatch applies an RFC 7386 merge patch to target and returns the result. Target may be modified in place, while
+// the patch is copied wherever it ends up in the result.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopy(patch)
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// patchStep is a validated PatchOp with parsed paths and a normalized value.
+type patchStep struct {
+	op    string
+	path  []string
+	from  []string
+	value interface{}
+}
+
+func newPatchStep(p PatchOp) (patchStep, error) {
+	s := patchStep{op: p.Op}
+	var err error
+	if s.path, err = parsePath(p.Path); err != nil {
+		return s, err
+	}
+	switch p.Op {
+	case "add", "replace", "test":
+		s.value, err = normalize(p.Value)
+	case "move", "copy":
+		if s.from, err = parsePath(p.From); err != nil {
+			return s, err
+		}
+		if p.Op == "move" && strings.HasPrefix(p.Path+"/", p.From+"/") && p.Path != p.From {
+			return s, fmt.Errorf("%w: cannot move %q into its own child", ErrInvalidPatch, p.From)
+		}
+	case "remove":
+	default:
+		return s, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, p.Op)
+	}
+	return s, err
+}
+
+// tree is one copy of the document.
+type tree struct {
+	root interface{}
+}
+
+func newTree() *tree {
+	return &tree{root: map[string]interface{}{}}
+}
+
+// set replaces the value at tokens. If insert is true, it is inserted into arrays rather than replacing an element.
+func (t *tree) set(tokens []string, value interface{}, insert bool) error {
+	if len(tokens) == 0 {
+		t.root = value
+		return nil
+	}
+	root, err := modify(t.root, tokens, func(parent interface{}, key string) (interface{}, error) {
+		return put(parent, key, value, insert)
+	})
+	if err == nil {
+		t.root = root
+	}
+	return err
+}
+
+func (t *tree) remove(tokens []string) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+	root, err := modify(t.root, tokens, remove)
+	if err == nil {
+		t.root = root
+	}
+	return err
+}
+
+func (t *tree) apply(s patchStep) error {
+	switch s.op {
+	case "add":
+		return t.set(s.path, deepCopy(s.value), true)
+	case "remove":
+		return t.remove(s.path)
+	case "replace":
+		if _, err := get(t.root, s.path); err != nil {
+			return err
+		}
+		return t.set(s.path, deepCopy(s.value), false)
+	case "move":
+		v, err := get(t.root, s.from)
+		if err != nil {
+			return err
+		}
+		if err = t.remove(s.from); err != nil {
+			return err
+		}
+		return t.set(s.path, v, true)
+	case "copy":
+		v, err := get(t.root, s.from)
+		if err != nil {
+			return err
+		}
+		return t.set(s.path, deepCopy(v), true)
+	case "test":
+		v, err := get(t.root, s.path)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(v, s.value) {
+			return fmt.Errorf("%w: value at %q differs", ErrTestFailed, "/"+strings.Join(s.path, "/"))
+		}
+	}
+	return nil
+}
+
+type setOp struct {
+	path  []string
+	value interface{}
+}
+
+type deleteOp struct {
+	path []string
+}
+
+type mergeOp struct {
+	path  []string
+	patch interface{}
+}
+
+type patchOp struct {
+	steps []patchStep
+}
+
+// Update applies a single document operation and returns the error it produced, if any. A failing operation fails the
+// same way on both sides, so they stay equal.
+func (t *tree) Update(op lock.Operation) lock.OpResult {
+	var err error
+	switch o := op.(type) {
+	case setOp:
+		err = t.set(o.path, deepCopy(o.value), false)
+	case deleteOp:
+		err = t.remove(o.path)
+	case mergeOp:
+		var cur interface{}
+		if len(o.path) == 0 {
+			cur = t.root
+		} else if parent, perr := get(t.root, o.path[:len(o.path)-1]); perr != nil {
+			return perr
+		} else if p, ok := parent.(map[string]interface{}); ok {
+			// Merging into a missing member is the same as merging into null.
+			cur = p[o.path[len(o.path)-1]]
+		} else if cur, err = get(parent, o.path[len(o.path)-1:]); err != nil {
+			return err
+		}
+		err = t.set(o.path, mergePatch(cur, o.patch), false)
+	case patchOp:
+		// Apply the patch to a copy, so that a failing operation leaves the document unchanged.
+		working := &tree{root: deepCopy(t.root)}
+		for i, s := range o.steps {
+			if err = working.apply(s); err != nil {
+				return fmt.Errorf("operation %d: %w", i, err)
+			}
+		}
+		t.root = working.root
+	default:
+		panic("lrdoc: unknown operation")
+	}
+	return err
+}
@@ -0,0 +1,190 @@
+package lrdoc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func mustGet(t *testing.T, d *Doc, path string) interface{} {
+	v, err := d.Get(path)
+	assert.Nil(t, err, path)
+	return v
+}
+
+func jsonOf(t *testing.T, d *Doc) string {
+	b, err := json.Marshal(d)
+	assert.Nil(t, err)
+	return string(b)
+}
+
+func TestSetGetDelete(t *testing.T) {
+	d := New()
+	assert.Nil(t, d.Set("/name", "svc"))
+	assert.Nil(t, d.Set("/ports", []int{80, 443}))
+	assert.Nil(t, d.Set("/limits", map[string]int{"rps": 100}))
+	assert.Equal(t, "{}", jsonOf(t, d))
+
+	d.Publish()
+	assert.Equal(t, `{"limits":{"rps":100},"name":"svc","ports":[80,443]}`, jsonOf(t, d))
+	assert.Equal(t, "svc", mustGet(t, d, "/name"))
+	assert.Equal(t, 443.0, mustGet(t, d, "/ports/1"))
+	assert.Equal(t, 100.0, mustGet(t, d, "/limits/rps"))
+
+	assert.Nil(t, d.Set("/ports/0", 8080))
+	assert.Nil(t, d.Set("/ports/-", 9090))
+	assert.Nil(t, d.Set("/ports/3", 9091))
+	assert.Nil(t, d.Delete("/limits/rps"))
+	d.Publish()
+	assert.Equal(t, []interface{}{8080.0, 443.0, 9090.0, 9091.0}, mustGet(t, d, "/ports"))
+	assert.Equal(t, map[string]interface{}{}, mustGet(t, d, "/limits"))
+
+	assert.Nil(t, d.Delete("/ports/1"))
+	d.Publish()
+	assert.Equal(t, []interface{}{8080.0, 9090.0, 9091.0}, mustGet(t, d, "/ports"))
+
+	// Check the other side as well.
+	d.Publish()
+	assert.Equal(t, `{"limits":{},"name":"svc","ports":[8080,9090,9091]}`, jsonOf(t, d))
+}
+
+func TestErrors(t *testing.T) {
+	d := New()
+	d.Set("/a", []int{1})
+	d.Set("/s", "scalar")
+	d.Publish()
+
+	assert.True(t, errors.Is(d.Set("a", 1), ErrInvalidPath))
+	assert.True(t, errors.Is(d.Set("/missing/b", 1), ErrNotFound))
+	assert.True(t, errors.Is(d.Set("/a/5", 1), ErrNotFound))
+	assert.True(t, errors.Is(d.Set("/a/01", 1), ErrInvalidPath))
+	assert.True(t, errors.Is(d.Set("/s/x", 1), ErrNotFound))
+	assert.True(t, errors.Is(d.Delete(""), ErrInvalidPath))
+	assert.True(t, errors.Is(d.Delete("/nope"), ErrNotFound))
+	assert.True(t, errors.Is(d.Delete("/a/-"), ErrInvalidPath))
+	assert.NotNil(t, d.Set("/x", func() {}))
+
+	_, err := d.Get("/a/1")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = d.Get("/s/0")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// Failed writes leave both sides unchanged.
+	d.Publish()
+	d.Publish()
+	assert.Equal(t, `{"a":[1],"s":"scalar"}`, jsonOf(t, d))
+}
+
+func TestEscapedPath(t *testing.T) {
+	d := New()
+	assert.Nil(t, d.Set("/a~1b", 1))
+	assert.Nil(t, d.Set("/c~0d", 2))
+	d.Publish()
+	assert.Equal(t, `{"a/b":1,"c~d":2}`, jsonOf(t, d))
+	assert.Equal(t, 1.0, mustGet(t, d, "/a~1b"))
+}
+
+func TestValuesAreCopied(t *testing.T) {
+	d := New()
+	in := map[string]interface{}{"list": []interface{}{1.0}}
+	d.Set("/x", in)
+	in["list"] = "changed"
+	d.Publish()
+
+	out := mustGet(t, d, "/x").(map[string]interface{})
+	out["list"] = "changed"
+	assert.Equal(t, []interface{}{1.0}, mustGet(t, d, "/x/list"))
+
+	// Nested writes on one side must not leak into the side readers are using.
+	d.Set("/x/list/-", 2.0)
+	assert.Equal(t, []interface{}{1.0}, mustGet(t, d, "/x/list"))
+}
+
+func TestMerge(t *testing.T) {
+	d := New()
+	d.Set("", map[string]interface{}{
+		"title":  "Goodbye!",
+		"author": map[string]interface{}{"givenName": "John", "familyName": "Doe"},
+		"tags":   []interface{}{"example", "sample"},
+	})
+	// The example from RFC 7386.
+	var patch interface{}
+	json.Unmarshal([]byte(`{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`), &patch)
+	assert.Nil(t, d.Merge("", patch))
+	d.Publish()
+	assert.Equal(t, `{"author":{"givenName":"John"},"phoneNumber":"+01-123-456-7890","tags":["example"],"title":"Hello!"}`, jsonOf(t, d))
+
+	assert.Nil(t, d.Merge("/author", map[string]interface{}{"age": 42}))
+	assert.Nil(t, d.Merge("/new", map[string]interface{}{"a": 1, "b": nil}))
+	assert.True(t, errors.Is(d.Merge("/missing/x", 1), ErrNotFound))
+	d.Publish()
+	assert.Equal(t, map[string]interface{}{"givenName": "John", "age": 42.0}, mustGet(t, d, "/author"))
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, mustGet(t, d, "/new"))
+}
+
+func TestApplyPatch(t *testing.T) {
+	d := New()
+	d.Set("", map[string]interface{}{"foo": []interface{}{"bar", "baz"}, "obj": map[string]interface{}{"x": 1}})
+	d.Publish()
+
+	var patch []PatchOp
+	assert.Nil(t, json.Unmarshal([]byte(`[
+		{"op": "test", "path": "/foo/0", "value": "bar"},
+		{"op": "add", "path": "/foo/1", "value": "qux"},
+		{"op": "remove", "path": "/foo/0"},
+		{"op": "replace", "path": "/obj/x", "value": 2},
+		{"op": "copy", "from": "/obj", "path": "/copy"},
+		{"op": "move", "from": "/obj/x", "path": "/moved"},
+		{"op": "add", "path": "/foo/-", "value": null}
+	]`), &patch))
+	assert.Nil(t, d.ApplyPatch(patch))
+	d.Publish()
+	assert.Equal(t, `{"copy":{"x":2},"foo":["qux","baz",null],"moved":2,"obj":{}}`, jsonOf(t, d))
+	d.Publish()
+	assert.Equal(t, `{"copy":{"x":2},"foo":["qux","baz",null],"moved":2,"obj":{}}`, jsonOf(t, d))
+}
+
+func TestApplyPatchIsAtomic(t *testing.T) {
+	d := New()
+	d.Set("/a", 1)
+	d.Publish()
+
+	err := d.ApplyPatch([]PatchOp{
+		{Op: "replace", Path: "/a", Value: 2},
+		{Op: "test", Path: "/a", Value: 3},
+	})
+	assert.True(t, errors.Is(err, ErrTestFailed))
+	err = d.ApplyPatch([]PatchOp{
+		{Op: "add", Path: "/b", Value: 2},
+		{Op: "remove", Path: "/c"},
+	})
+	assert.True(t, errors.Is(err, ErrNotFound))
+	d.Publish()
+	assert.Equal(t, `{"a":1}`, jsonOf(t, d))
+
+	assert.True(t, errors.Is(d.ApplyPatch([]PatchOp{{Op: "nope", Path: "/a"}}), ErrInvalidPatch))
+	assert.True(t, errors.Is(d.ApplyPatch([]PatchOp{{Op: "move", From: "/a", Path: "/a/b"}}), ErrInvalidPatch))
+	assert.True(t, errors.Is(d.ApplyPatch([]PatchOp{{Op: "remove", Path: ""}}), ErrInvalidPatch))
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	d := New()
+	d.Set("/list", []int{})
+	d.Publish()
+	lrtest.ConcurrentReaders(300, func(int) {
+		// Elements are always appended in pairs.
+		list, err := d.Get("/list")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(list.([]interface{}))%2)
+		_, err = d.MarshalJSON()
+		assert.Nil(t, err)
+	}, func(i int) {
+		d.Set("/list/-", i)
+		d.Set("/list/-", i)
+		d.Publish()
+	})
+}
@@ -0,0 +1,286 @@
+package lrgraph
+
+import (
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// Graph is a directed graph over nodes of type N, protected by a LeftRightLock. AddNode, AddEdge, RemoveEdge,
+// RemoveNode and Publish are writes, all the other methods are reads.
+//
+// Every traversal holds a read lock for its whole duration, so it always runs against a single consistent version of
+// the graph. Out-edges are kept in the order they were added, which makes traversals deterministic.
+type Graph[N comparable] struct {
+	lr *lock.LeftRightLock
+}
+
+// New creates an empty Graph.
+func New[N comparable]() *Graph[N] {
+	return &Graph[N]{lr: lock.NewLeftRightLock(newGraph[N](), newGraph[N]())}
+}
+
+// AddNode adds a node without any edges. Returns true if it was not in the graph before.
+func (g *Graph[N]) AddNode(n N) bool {
+	return g.lr.Write(addNodeOp[N]{n}).(bool)
+}
+
+// AddEdge adds an edge from one node to another, adding the nodes as well if needed. Returns true if the edge was not
+// in the graph before.
+func (g *Graph[N]) AddEdge(from, to N) bool {
+	return g.lr.Write(addEdgeOp[N]{from, to}).(bool)
+}
+
+// RemoveEdge removes the edge between two nodes, but keeps the nodes. Returns true if the edge was in the graph.
+func (g *Graph[N]) RemoveEdge(from, to N) bool {
+	return g.lr.Write(removeEdgeOp[N]{from, to}).(bool)
+}
+
+// RemoveNode removes a node along with all its incoming and outgoing edges. Returns true if it was in the graph.
+func (g *Graph[N]) RemoveNode(n N) bool {
+	return g.lr.Write(removeNodeOp[N]{n}).(bool)
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (g *Graph[N]) Publish() {
+	g.lr.Publish()
+}
+
+// Len returns the number of nodes in the graph.
+func (g *Graph[N]) Len() int {
+	data, art := g.lr.RLock()
+	defer g.lr.RUnlock(art)
+	return len(data.(*graph[N]).vertices)
+}
+
+// HasNode returns true if n is in the graph.
+func (g *Graph[N]) HasNode(n N) bool {
+	data, art := g.lr.RLock()
+	defer g.lr.RUnlock(art)
+	_, ok := data.(*graph[N]).vertices[n]
+	return ok
+}
+
+// Neighbors returns the nodes n has edges to, in the order the edges were added.
+func (g *Graph[N]) Neighbors(n N) []N {
+	data, art := g.lr.RLock()
+	defer g.lr.RUnlock(art)
+	v, ok := data.(*graph[N]).vertices[n]
+	if !ok {
+		return nil
+	}
+	res := make([]N, len(v.out))
+	copy(res, v.out)
+	return res
+}
+
+// BFS visits all nodes reachable from start in breadth-first order and calls fn with each node and its distance from
+// start, until fn returns false.
+func (g *Graph[N]) BFS(start N, fn func(n N, depth int) bool) {
+	data, art := g.lr.RLock()
+	defer g.lr.RUnlock(art)
+	gr := data.(*graph[N])
+	if _, ok := gr.vertices[start]; !ok {
+		return
+	}
+	depth := map[N]int{start: 0}
+	queue := []N{start}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if !fn(n, depth[n]) {
+			return
+		}
+		for _, m := range gr.vertices[n].out {
+			if _, seen := depth[m]; !seen {
+				depth[m] = depth[n] + 1
+				queue = append(queue, m)
+			}
+		}
+	}
+}
+
+// ShortestPath returns a path with the fewest edges between two nodes, including both of them. Returns false if there
+// is no such path.
+func (g *Graph[N]) ShortestPath(from, to N) ([]N, bool) {
+	data, art := g.lr.RLock()
+	defer g.lr.RUnlock(art)
+	gr := data.(*graph[N])
+	if _, ok := gr.vertices[from]; !ok {
+		return nil, false
+	}
+	if _, ok := gr.vertices[to]; !ok {
+		return nil, false
+	}
+	// prev maps every visited node to the node it was reached from. from maps to itself.
+	prev := map[N]N{from: from}
+	queue := []N{from}
+	for len(queue) > 0 && !hasKey(prev, to) {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range gr.vertices[n].out {
+			if !hasKey(prev, m) {
+				prev[m] = n
+				queue = append(queue, m)
+			}
+		}
+	}
+	if !hasKey(prev, to) {
+		return nil, false
+	}
+	// Walk back from the target and reverse the path.
+	var path []N
+	for n := to; ; n = prev[n] {
+		path = append(path, n)
+		if n == from {
+			break
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, true
+}
+
+// HasCycle returns true if the graph has a directed cycle, including self-loops.
+func (g *Graph[N]) HasCycle() bool {
+	data, art := g.lr.RLock()
+	defer g.lr.RUnlock(art)
+	gr := data.(*graph[N])
+
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+	// frame is a node on the DFS stack along with the index of the next out-edge to explore.
+	type frame struct {
+		n    N
+		next int
+	}
+	state := make(map[N]int, len(gr.vertices))
+	for start := range gr.vertices {
+		if state[start] != unvisited {
+			continue
+		}
+		stack := []frame{{start, 0}}
+		state[start] = onStack
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			out := gr.vertices[top.n].out
+			if top.next == len(out) {
+				state[top.n] = done
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			m := out[top.next]
+			top.next++
+			switch state[m] {
+			case onStack:
+				return true
+			case unvisited:
+				state[m] = onStack
+				stack = append(stack, frame{m, 0})
+			}
+		}
+	}
+	return false
+}
+
+func hasKey[N comparable](m map[N]N, n N) bool {
+	_, ok := m[n]
+	return ok
+}
+
+// vertex holds the edges of a single node.
+type vertex[N comparable] struct {
+	// out holds the targets of out-edges in the order they were added.
+	out []N
+	// in holds the sources of in-edges, so a node can be removed without scanning the whole graph.
+	in map[N]struct{}
+}
+
+// graph is one copy of the graph.
+type graph[N comparable] struct {
+	vertices map[N]*vertex[N]
+}
+
+func newGraph[N comparable]() *graph[N] {
+	return &graph[N]{vertices: make(map[N]*vertex[N])}
+}
+
+func (g *graph[N]) addNode(n N) (*vertex[N], bool) {
+	if v, ok := g.vertices[n]; ok {
+		return v, false
+	}
+	v := &vertex[N]{in: make(map[N]struct{})}
+	g.vertices[n] = v
+	return v, true
+}
+
+// removeOut removes to from the out-edges of v, keeping the order of the others.
+func (v *vertex[N]) removeOut(to N) bool {
+	for i, m := range v.out {
+		if m == to {
+			copy(v.out[i:], v.out[i+1:])
+			var zero N
+			v.out[len(v.out)-1] = zero
+			v.out = v.out[:len(v.out)-1]
+			return true
+		}
+	}
+	return false
+}
+
+type addNodeOp[N comparable] struct {
+	n N
+}
+
+type addEdgeOp[N comparable] struct {
+	from, to N
+}
+
+type removeEdgeOp[N comparable] struct {
+	from, to N
+}
+
+type removeNodeOp[N comparable] struct {
+	n N
+}
+
+// Update applies a single graph operation.
+func (g *graph[N]) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case addNodeOp[N]:
+		_, added := g.addNode(o.n)
+		return added
+	case addEdgeOp[N]:
+		from, _ := g.addNode(o.from)
+		to, _ := g.addNode(o.to)
+		if _, ok := to.in[o.from]; ok {
+			return false
+		}
+		from.out = append(from.out, o.to)
+		to.in[o.from] = struct{}{}
+		return true
+	case removeEdgeOp[N]:
+		from, ok := g.vertices[o.from]
+		if !ok || !from.removeOut(o.to) {
+			return false
+		}
+		delete(g.vertices[o.to].in, o.from)
+		return true
+	case removeNodeOp[N]:
+		v, ok := g.vertices[o.n]
+		if !ok {
+			return false
+		}
+		for src := range v.in {
+			g.vertices[src].removeOut(o.n)
+		}
+		for _, dst := range v.out {
+			delete(g.vertices[dst].in, o.n)
+		}
+		delete(g.vertices, o.n)
+		return true
+	}
+	panic("lrgraph: unknown operation")
+}
@@ -0,0 +1,161 @@
+package lrgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func TestBasic(t *testing.T) {
+	g := New[string]()
+	assert.True(t, g.AddNode("a"))
+	assert.False(t, g.AddNode("a"))
+	assert.True(t, g.AddEdge("a", "b"))
+	assert.False(t, g.AddEdge("a", "b"))
+	assert.True(t, g.AddEdge("a", "c"))
+	assert.False(t, g.HasNode("a"))
+
+	g.Publish()
+	assert.Equal(t, 3, g.Len())
+	assert.True(t, g.HasNode("b"))
+	assert.Equal(t, []string{"b", "c"}, g.Neighbors("a"))
+	assert.Empty(t, g.Neighbors("b"))
+	assert.Nil(t, g.Neighbors("x"))
+
+	assert.True(t, g.RemoveEdge("a", "b"))
+	assert.False(t, g.RemoveEdge("a", "b"))
+	assert.False(t, g.RemoveEdge("x", "b"))
+	g.Publish()
+	assert.Equal(t, []string{"c"}, g.Neighbors("a"))
+	assert.True(t, g.HasNode("b"))
+
+	assert.True(t, g.RemoveNode("c"))
+	assert.False(t, g.RemoveNode("c"))
+	g.Publish()
+	assert.Empty(t, g.Neighbors("a"))
+	assert.Equal(t, 2, g.Len())
+
+	// Check the other side as well.
+	g.Publish()
+	assert.Empty(t, g.Neighbors("a"))
+	assert.Equal(t, 2, g.Len())
+}
+
+func TestRemoveNodeDropsEdges(t *testing.T) {
+	g := New[string]()
+	g.AddEdge("a", "b")
+	g.AddEdge("b", "c")
+	g.AddEdge("c", "b")
+	g.AddEdge("b", "b")
+	g.RemoveNode("b")
+	g.Publish()
+	assert.Empty(t, g.Neighbors("a"))
+	assert.Empty(t, g.Neighbors("c"))
+
+	// Re-adding the node doesn't bring back its old edges.
+	g.AddNode("b")
+	g.Publish()
+	assert.Empty(t, g.Neighbors("b"))
+	assert.False(t, g.HasCycle())
+}
+
+func TestBFS(t *testing.T) {
+	g := New[int]()
+	g.AddEdge(1, 2)
+	g.AddEdge(1, 3)
+	g.AddEdge(2, 4)
+	g.AddEdge(3, 4)
+	g.AddEdge(4, 1)
+	g.AddNode(5)
+	g.Publish()
+
+	var order []int
+	var depths []int
+	g.BFS(1, func(n int, depth int) bool {
+		order = append(order, n)
+		depths = append(depths, depth)
+		return true
+	})
+	assert.Equal(t, []int{1, 2, 3, 4}, order)
+	assert.Equal(t, []int{0, 1, 1, 2}, depths)
+
+	order = nil
+	g.BFS(1, func(n int, _ int) bool {
+		order = append(order, n)
+		return len(order) < 2
+	})
+	assert.Equal(t, []int{1, 2}, order)
+
+	called := false
+	g.BFS(42, func(int, int) bool {
+		called = true
+		return true
+	})
+	assert.False(t, called)
+}
+
+func TestShortestPath(t *testing.T) {
+	g := New[string]()
+	g.AddEdge("a", "b")
+	g.AddEdge("b", "c")
+	g.AddEdge("c", "d")
+	g.AddEdge("a", "x")
+	g.AddEdge("x", "d")
+	g.AddNode("lonely")
+	g.Publish()
+
+	path, ok := g.ShortestPath("a", "d")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "x", "d"}, path)
+
+	path, ok = g.ShortestPath("a", "a")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a"}, path)
+
+	_, ok = g.ShortestPath("d", "a")
+	assert.False(t, ok)
+	_, ok = g.ShortestPath("a", "lonely")
+	assert.False(t, ok)
+	_, ok = g.ShortestPath("a", "missing")
+	assert.False(t, ok)
+}
+
+func TestHasCycle(t *testing.T) {
+	g := New[int]()
+	g.AddEdge(1, 2)
+	g.AddEdge(2, 3)
+	g.AddEdge(1, 3)
+	g.Publish()
+	assert.False(t, g.HasCycle())
+
+	g.AddEdge(3, 1)
+	g.Publish()
+	assert.True(t, g.HasCycle())
+
+	g.RemoveEdge(3, 1)
+	g.AddEdge(4, 4)
+	g.Publish()
+	assert.True(t, g.HasCycle())
+
+	g.RemoveNode(4)
+	g.Publish()
+	assert.False(t, g.HasCycle())
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	g := New[int]()
+	g.AddEdge(0, 1)
+	g.Publish()
+	lrtest.ConcurrentReaders(500, func(int) {
+		// The writer keeps a chain 0 -> 1 -> ... and always publishes it whole.
+		path, ok := g.ShortestPath(0, 1)
+		assert.True(t, ok)
+		assert.Len(t, path, 2)
+		assert.False(t, g.HasCycle())
+	}, func(i int) {
+		g.AddEdge(i+1, i+2)
+		g.Publish()
+	})
+}
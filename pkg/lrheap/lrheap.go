@@ -0,0 +1,242 @@
+package lrheap
+
+import (
+	"container/heap"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// Handle identifies an item pushed onto a Heap, so it can later be fixed or removed. Handles are never reused.
+type Handle uint64
+
+// Item is a single value stored in the Heap along with its priority. Items with lower priority are popped first and
+// items with equal priority are popped in the order they were pushed.
+type Item[V any] struct {
+	Handle   Handle
+	Value    V
+	Priority int64
+}
+
+// Heap is a priority queue of values of type V, protected by a LeftRightLock. Push, Pop, Fix, Remove and Publish are
+// writes, while Peek, TopK and Len are reads.
+type Heap[V any] struct {
+	lr *lock.LeftRightLock
+	// lastHandle is the handle assigned to the last pushed item. The writer assigns handles, so both sides agree on
+	// them.
+	lastHandle Handle
+}
+
+// New creates an empty Heap.
+func New[V any]() *Heap[V] {
+	return &Heap[V]{lr: lock.NewLeftRightLock(newSide[V](), newSide[V]())}
+}
+
+// Push adds a value with the given priority and returns its handle.
+func (h *Heap[V]) Push(value V, priority int64) Handle {
+	h.lastHandle++
+	h.lr.Write(pushOp[V]{Item[V]{h.lastHandle, value, priority}})
+	return h.lastHandle
+}
+
+// Pop removes the item with the lowest priority and returns it. Returns false if the heap is empty.
+func (h *Heap[V]) Pop() (Item[V], bool) {
+	res := h.lr.Write(popOp{}).(result[V])
+	return res.item, res.ok
+}
+
+// Fix changes the priority of the item with the given handle. Returns false if there is no such item.
+func (h *Heap[V]) Fix(handle Handle, priority int64) bool {
+	return h.lr.Write(fixOp{handle, priority}).(result[V]).ok
+}
+
+// Remove removes the item with the given handle and returns it. Returns false if there is no such item.
+func (h *Heap[V]) Remove(handle Handle) (Item[V], bool) {
+	res := h.lr.Write(removeOp{handle}).(result[V])
+	return res.item, res.ok
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (h *Heap[V]) Publish() {
+	h.lr.Publish()
+}
+
+// Peek returns the item with the lowest priority without removing it. Returns false if the heap is empty.
+func (h *Heap[V]) Peek() (Item[V], bool) {
+	data, art := h.lr.RLock()
+	defer h.lr.RUnlock(art)
+	s := data.(*side[V])
+	if len(s.nodes) == 0 {
+		return Item[V]{}, false
+	}
+	return s.nodes[0].Item, true
+}
+
+// TopK returns up to k items with the lowest priorities, in the order they would be popped. It runs in O(k log k)
+// without modifying the heap.
+func (h *Heap[V]) TopK(k int) []Item[V] {
+	data, art := h.lr.RLock()
+	defer h.lr.RUnlock(art)
+	s := data.(*side[V])
+	if k > len(s.nodes) {
+		k = len(s.nodes)
+	}
+	if k <= 0 {
+		return nil
+	}
+	// Do a best-first walk of the heap tree. Every popped candidate is the next smallest item, and its children are
+	// the only new items that can follow it.
+	res := make([]Item[V], 0, k)
+	cand := &candidates[V]{nodes: s.nodes, idx: []int{0}}
+	for len(res) < k {
+		i := heap.Pop(cand).(int)
+		res = append(res, s.nodes[i].Item)
+		for _, c := range []int{2*i + 1, 2*i + 2} {
+			if c < len(s.nodes) {
+				heap.Push(cand, c)
+			}
+		}
+	}
+	return res
+}
+
+// Len returns the number of items in the heap.
+func (h *Heap[V]) Len() int {
+	data, art := h.lr.RLock()
+	defer h.lr.RUnlock(art)
+	return len(data.(*side[V]).nodes)
+}
+
+// node is an Item stored on a single side along with its position in the heap array.
+type node[V any] struct {
+	Item[V]
+	index int
+}
+
+// nodes is a min-heap of nodes implementing heap.Interface.
+type nodes[V any] []*node[V]
+
+func (n nodes[V]) Len() int {
+	return len(n)
+}
+
+func (n nodes[V]) Less(i, j int) bool {
+	if n[i].Priority != n[j].Priority {
+		return n[i].Priority < n[j].Priority
+	}
+	return n[i].Handle < n[j].Handle
+}
+
+func (n nodes[V]) Swap(i, j int) {
+	n[i], n[j] = n[j], n[i]
+	n[i].index = i
+	n[j].index = j
+}
+
+func (n *nodes[V]) Push(x interface{}) {
+	nd := x.(*node[V])
+	nd.index = len(*n)
+	*n = append(*n, nd)
+}
+
+func (n *nodes[V]) Pop() interface{} {
+	old := *n
+	nd := old[len(old)-1]
+	old[len(old)-1] = nil
+	*n = old[:len(old)-1]
+	return nd
+}
+
+// candidates is a min-heap of indices into nodes, used by TopK to walk the heap without modifying it.
+type candidates[V any] struct {
+	nodes nodes[V]
+	idx   []int
+}
+
+func (c *candidates[V]) Len() int {
+	return len(c.idx)
+}
+
+func (c *candidates[V]) Less(i, j int) bool {
+	return c.nodes.Less(c.idx[i], c.idx[j])
+}
+
+func (c *candidates[V]) Swap(i, j int) {
+	c.idx[i], c.idx[j] = c.idx[j], c.idx[i]
+}
+
+func (c *candidates[V]) Push(x interface{}) {
+	c.idx = append(c.idx, x.(int))
+}
+
+func (c *candidates[V]) Pop() interface{} {
+	i := c.idx[len(c.idx)-1]
+	c.idx = c.idx[:len(c.idx)-1]
+	return i
+}
+
+// side is one copy of the heap, along with an index of its nodes by handle.
+type side[V any] struct {
+	nodes    nodes[V]
+	byHandle map[Handle]*node[V]
+}
+
+func newSide[V any]() *side[V] {
+	return &side[V]{byHandle: make(map[Handle]*node[V])}
+}
+
+type pushOp[V any] struct {
+	item Item[V]
+}
+
+type popOp struct{}
+
+type fixOp struct {
+	handle   Handle
+	priority int64
+}
+
+type removeOp struct {
+	handle Handle
+}
+
+// result is returned by Update for every operation.
+type result[V any] struct {
+	item Item[V]
+	ok   bool
+}
+
+// Update applies a single heap operation. Since both sides start out equal and ties are broken by handle, both sides
+// pop and remove exactly the same items, as required by LeftRightStructure.
+func (s *side[V]) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case pushOp[V]:
+		nd := &node[V]{Item: o.item}
+		heap.Push(&s.nodes, nd)
+		s.byHandle[nd.Handle] = nd
+		return result[V]{nd.Item, true}
+	case popOp:
+		if len(s.nodes) == 0 {
+			return result[V]{}
+		}
+		nd := heap.Pop(&s.nodes).(*node[V])
+		delete(s.byHandle, nd.Handle)
+		return result[V]{nd.Item, true}
+	case fixOp:
+		nd, ok := s.byHandle[o.handle]
+		if !ok {
+			return result[V]{}
+		}
+		nd.Priority = o.priority
+		heap.Fix(&s.nodes, nd.index)
+		return result[V]{nd.Item, true}
+	case removeOp:
+		nd, ok := s.byHandle[o.handle]
+		if !ok {
+			return result[V]{}
+		}
+		heap.Remove(&s.nodes, nd.index)
+		delete(s.byHandle, nd.Handle)
+		return result[V]{nd.Item, true}
+	}
+	panic("lrheap: unknown operation")
+}
@@ -0,0 +1,149 @@
+package lrheap
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func values[V any](items []Item[V]) (res []V) {
+	for _, it := range items {
+		res = append(res, it.Value)
+	}
+	return
+}
+
+func TestBasic(t *testing.T) {
+	h := New[string]()
+	_, ok := h.Peek()
+	assert.False(t, ok)
+	_, ok = h.Pop()
+	assert.False(t, ok)
+
+	h.Push("c", 3)
+	h.Push("a", 1)
+	h.Push("b", 2)
+	assert.Equal(t, 0, h.Len())
+
+	h.Publish()
+	assert.Equal(t, 3, h.Len())
+	it, ok := h.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "a", it.Value)
+
+	it, ok = h.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "a", it.Value)
+	assert.Equal(t, int64(1), it.Priority)
+
+	// Readers still see the popped item until we publish.
+	it, _ = h.Peek()
+	assert.Equal(t, "a", it.Value)
+	h.Publish()
+	it, _ = h.Peek()
+	assert.Equal(t, "b", it.Value)
+	assert.Equal(t, 2, h.Len())
+}
+
+func TestFixRemove(t *testing.T) {
+	h := New[string]()
+	a := h.Push("a", 1)
+	b := h.Push("b", 2)
+	c := h.Push("c", 3)
+
+	assert.True(t, h.Fix(c, 0))
+	assert.False(t, h.Fix(Handle(100), 0))
+	it, ok := h.Remove(a)
+	assert.True(t, ok)
+	assert.Equal(t, "a", it.Value)
+	_, ok = h.Remove(a)
+	assert.False(t, ok)
+	h.Publish()
+	assert.Equal(t, []string{"c", "b"}, values(h.TopK(10)))
+
+	// Publish again so the other side is checked as well.
+	h.Publish()
+	assert.Equal(t, []string{"c", "b"}, values(h.TopK(10)))
+
+	it, _ = h.Pop()
+	assert.Equal(t, c, it.Handle)
+	it, _ = h.Pop()
+	assert.Equal(t, b, it.Handle)
+}
+
+func TestTiesPopInPushOrder(t *testing.T) {
+	h := New[int]()
+	for i := 0; i < 10; i++ {
+		h.Push(i, 7)
+	}
+	h.Publish()
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, values(h.TopK(10)))
+	for i := 0; i < 10; i++ {
+		it, _ := h.Pop()
+		assert.Equal(t, i, it.Value)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	h := New[int]()
+	prios := rand.Perm(100)
+	for _, p := range prios {
+		h.Push(p, int64(p))
+	}
+	h.Publish()
+
+	assert.Nil(t, h.TopK(0))
+	assert.Len(t, h.TopK(1000), 100)
+
+	top := h.TopK(10)
+	sort.Ints(prios)
+	for i, it := range top {
+		assert.Equal(t, int64(prios[i]), it.Priority)
+	}
+	// TopK does not modify the heap.
+	assert.Equal(t, 100, h.Len())
+}
+
+func TestSidesConsistent(t *testing.T) {
+	h := New[int]()
+	var handles []Handle
+	for i := 0; i < 1000; i++ {
+		switch r := rand.Intn(10); {
+		case r < 5 || len(handles) == 0:
+			handles = append(handles, h.Push(i, int64(rand.Intn(50))))
+		case r < 7:
+			h.Pop()
+		case r < 9:
+			h.Fix(handles[rand.Intn(len(handles))], int64(rand.Intn(50)))
+		default:
+			h.Remove(handles[rand.Intn(len(handles))])
+		}
+		if i%10 == 0 {
+			h.Publish()
+		}
+	}
+	h.Publish()
+	first := h.TopK(h.Len())
+	h.Publish()
+	assert.Equal(t, first, h.TopK(h.Len()))
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	h := New[int]()
+	lrtest.ConcurrentReaders(1000, func(int) {
+		top := h.TopK(5)
+		for j := 1; j < len(top); j++ {
+			assert.LessOrEqual(t, top[j-1].Priority, top[j].Priority)
+		}
+	}, func(i int) {
+		h.Push(i, int64(rand.Intn(100)))
+		if i%3 == 0 {
+			h.Pop()
+		}
+		h.Publish()
+	})
+}
@@ -0,0 +1,245 @@
+package lrindex
+
+import (
+	"sort"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// DocID identifies an indexed document.
+type DocID uint64
+
+// Mode determines how the results for individual search terms are combined.
+type Mode int
+
+const (
+	// And only matches documents containing all the search terms.
+	And Mode = iota
+	// Or matches documents containing any of the search terms.
+	Or
+)
+
+// Index is an inverted index protected by a LeftRightLock. IndexDoc, DeleteDoc and Publish are writes, while Search,
+// Terms and Len are reads. A whole batch of reindexed documents can be published at once.
+type Index struct {
+	lr *lock.LeftRightLock
+}
+
+// New creates an empty Index.
+func New() *Index {
+	return &Index{lr: lock.NewLeftRightLock(newPostings(), newPostings())}
+}
+
+// IndexDoc indexes the document with the given terms, replacing any terms it was indexed with before. Duplicate terms
+// are ignored.
+func (ix *Index) IndexDoc(id DocID, terms []string) {
+	ix.lr.Write(indexOp{id, dedup(terms)})
+}
+
+// DeleteDoc removes the document from the index. Returns true if it was indexed.
+func (ix *Index) DeleteDoc(id DocID) bool {
+	return ix.lr.Write(deleteOp{id}).(bool)
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (ix *Index) Publish() {
+	ix.lr.Publish()
+}
+
+// Len returns the number of indexed documents.
+func (ix *Index) Len() int {
+	data, art := ix.lr.RLock()
+	defer ix.lr.RUnlock(art)
+	return len(data.(*postings).docs)
+}
+
+// Terms returns the sorted terms the document is indexed with.
+func (ix *Index) Terms(id DocID) ([]string, bool) {
+	data, art := ix.lr.RLock()
+	defer ix.lr.RUnlock(art)
+	terms, ok := data.(*postings).docs[id]
+	if !ok {
+		return nil, false
+	}
+	res := make([]string, len(terms))
+	copy(res, terms)
+	return res, true
+}
+
+// Search returns the sorted IDs of documents matching the terms in the given mode. Searching for no terms matches no
+// documents.
+func (ix *Index) Search(terms []string, mode Mode) []DocID {
+	data, art := ix.lr.RLock()
+	defer ix.lr.RUnlock(art)
+	p := data.(*postings)
+
+	var lists [][]DocID
+	for _, term := range dedup(terms) {
+		list, ok := p.terms[term]
+		if !ok && mode == And {
+			return nil
+		}
+		if ok {
+			lists = append(lists, list)
+		}
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+	if mode == And {
+		return intersect(lists)
+	}
+	return union(lists)
+}
+
+// dedup returns a sorted copy of terms without duplicates.
+func dedup(terms []string) []string {
+	res := make([]string, len(terms))
+	copy(res, terms)
+	sort.Strings(res)
+	n := 0
+	for i, term := range res {
+		if i == 0 || term != res[n-1] {
+			res[n] = term
+			n++
+		}
+	}
+	return res[:n]
+}
+
+// search returns the index of the first element in list[lo:] that is not smaller than id. It gallops forward before
+// binary searching, so walking through a long list in small steps stays cheap.
+func search(list []DocID, lo int, id DocID) int {
+	step := 1
+	hi := lo
+	for hi < len(list) && list[hi] < id {
+		lo = hi + 1
+		hi += step
+		step *= 2
+	}
+	if hi > len(list) {
+		hi = len(list)
+	}
+	return lo + sort.Search(hi-lo, func(i int) bool { return list[lo+i] >= id })
+}
+
+// intersect returns the sorted IDs present in all lists. Lists are never modified.
+func intersect(lists [][]DocID) []DocID {
+	// Start with the shortest list, as the result can't be longer than it.
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	pos := make([]int, len(lists))
+	var res []DocID
+outer:
+	for _, id := range lists[0] {
+		for i := 1; i < len(lists); i++ {
+			pos[i] = search(lists[i], pos[i], id)
+			if pos[i] == len(lists[i]) {
+				break outer
+			}
+			if lists[i][pos[i]] != id {
+				continue outer
+			}
+		}
+		res = append(res, id)
+	}
+	return res
+}
+
+// union returns the sorted IDs present in any of the lists. Lists are never modified.
+func union(lists [][]DocID) []DocID {
+	res := make([]DocID, len(lists[0]))
+	copy(res, lists[0])
+	for _, list := range lists[1:] {
+		merged := make([]DocID, 0, len(res)+len(list))
+		i, j := 0, 0
+		for i < len(res) && j < len(list) {
+			switch {
+			case res[i] < list[j]:
+				merged = append(merged, res[i])
+				i++
+			case res[i] > list[j]:
+				merged = append(merged, list[j])
+				j++
+			default:
+				merged = append(merged, res[i])
+				i++
+				j++
+			}
+		}
+		merged = append(merged, res[i:]...)
+		res = append(merged, list[j:]...)
+	}
+	return res
+}
+
+// postings is one copy of the index.
+type postings struct {
+	// terms maps every term to the sorted IDs of documents containing it.
+	terms map[string][]DocID
+	// docs maps every document to its sorted terms, so it can be removed from the posting lists.
+	docs map[DocID][]string
+}
+
+func newPostings() *postings {
+	return &postings{
+		terms: make(map[string][]DocID),
+		docs:  make(map[DocID][]string),
+	}
+}
+
+func (p *postings) add(id DocID, term string) {
+	list := p.terms[term]
+	i := sort.Search(len(list), func(i int) bool { return list[i] >= id })
+	list = append(list, 0)
+	copy(list[i+1:], list[i:])
+	list[i] = id
+	p.terms[term] = list
+}
+
+func (p *postings) remove(id DocID, term string) {
+	list := p.terms[term]
+	i := sort.Search(len(list), func(i int) bool { return list[i] >= id })
+	if len(list) == 1 {
+		delete(p.terms, term)
+		return
+	}
+	p.terms[term] = append(list[:i], list[i+1:]...)
+}
+
+func (p *postings) deleteDoc(id DocID) bool {
+	terms, ok := p.docs[id]
+	if !ok {
+		return false
+	}
+	for _, term := range terms {
+		p.remove(id, term)
+	}
+	delete(p.docs, id)
+	return true
+}
+
+type indexOp struct {
+	id    DocID
+	terms []string
+}
+
+type deleteOp struct {
+	id DocID
+}
+
+// Update applies a single index operation.
+func (p *postings) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case indexOp:
+		p.deleteDoc(o.id)
+		for _, term := range o.terms {
+			p.add(o.id, term)
+		}
+		// The terms were deduplicated and copied by the writer and are never modified, so both sides can share them.
+		p.docs[o.id] = o.terms
+		return nil
+	case deleteOp:
+		return p.deleteDoc(o.id)
+	}
+	panic("lrindex: unknown operation")
+}
@@ -0,0 +1,135 @@
+package lrindex
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func TestBasic(t *testing.T) {
+	ix := New()
+	ix.IndexDoc(3, []string{"quick", "brown", "fox"})
+	ix.IndexDoc(1, []string{"lazy", "brown", "dog"})
+	ix.IndexDoc(2, []string{"quick", "dog", "dog"})
+	assert.Nil(t, ix.Search([]string{"dog"}, Or))
+
+	ix.Publish()
+	assert.Equal(t, 3, ix.Len())
+	assert.Equal(t, []DocID{1, 2}, ix.Search([]string{"dog"}, And))
+	assert.Equal(t, []DocID{2}, ix.Search([]string{"dog", "quick"}, And))
+	assert.Equal(t, []DocID{1, 2, 3}, ix.Search([]string{"dog", "quick"}, Or))
+	assert.Equal(t, []DocID{1, 3}, ix.Search([]string{"brown", "cat"}, Or))
+	assert.Nil(t, ix.Search([]string{"brown", "cat"}, And))
+	assert.Nil(t, ix.Search(nil, And))
+	assert.Nil(t, ix.Search(nil, Or))
+
+	terms, ok := ix.Terms(2)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"dog", "quick"}, terms)
+	_, ok = ix.Terms(42)
+	assert.False(t, ok)
+}
+
+func TestReindexAndDelete(t *testing.T) {
+	ix := New()
+	ix.IndexDoc(1, []string{"a", "b"})
+	ix.IndexDoc(2, []string{"b"})
+	ix.Publish()
+
+	// Reindexing replaces the old terms.
+	ix.IndexDoc(1, []string{"c"})
+	assert.True(t, ix.DeleteDoc(2))
+	assert.False(t, ix.DeleteDoc(2))
+	ix.Publish()
+
+	assert.Nil(t, ix.Search([]string{"a"}, Or))
+	assert.Nil(t, ix.Search([]string{"b"}, Or))
+	assert.Equal(t, []DocID{1}, ix.Search([]string{"c"}, Or))
+	assert.Equal(t, 1, ix.Len())
+
+	// Check the other side as well.
+	ix.Publish()
+	assert.Nil(t, ix.Search([]string{"b"}, Or))
+	assert.Equal(t, []DocID{1}, ix.Search([]string{"c"}, Or))
+}
+
+func TestSearchDoesNotModifyPostings(t *testing.T) {
+	ix := New()
+	ix.IndexDoc(1, []string{"a"})
+	ix.IndexDoc(2, []string{"a", "b"})
+	ix.Publish()
+	res := ix.Search([]string{"a"}, Or)
+	res[0] = 100
+	assert.Equal(t, []DocID{1, 2}, ix.Search([]string{"a"}, Or))
+}
+
+func TestRandomAgainstNaive(t *testing.T) {
+	ix := New()
+	vocab := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	ref := make(map[DocID]map[string]bool)
+	for i := 0; i < 2000; i++ {
+		id := DocID(rand.Intn(300))
+		if rand.Intn(4) == 0 {
+			ix.DeleteDoc(id)
+			delete(ref, id)
+			continue
+		}
+		var terms []string
+		ref[id] = make(map[string]bool)
+		for _, term := range vocab {
+			if rand.Intn(3) == 0 {
+				terms = append(terms, term)
+				ref[id][term] = true
+			}
+		}
+		ix.IndexDoc(id, terms)
+		if i%100 == 0 {
+			ix.Publish()
+		}
+	}
+	// Check both sides.
+	for s := 0; s < 2; s++ {
+		ix.Publish()
+		for q := 0; q < 100; q++ {
+			query := []string{vocab[rand.Intn(len(vocab))], vocab[rand.Intn(len(vocab))], vocab[rand.Intn(len(vocab))]}
+			for _, mode := range []Mode{And, Or} {
+				var want []DocID
+				for id, terms := range ref {
+					match := mode == And
+					for _, term := range query {
+						if mode == And {
+							match = match && terms[term]
+						} else {
+							match = match || terms[term]
+						}
+					}
+					if match {
+						want = append(want, id)
+					}
+				}
+				sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+				assert.Equal(t, want, ix.Search(query, mode), query)
+			}
+		}
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	ix := New()
+	lrtest.ConcurrentReaders(500, func(int) {
+		res := ix.Search([]string{"x", "y"}, And)
+		for j := 1; j < len(res); j++ {
+			assert.Less(t, res[j-1], res[j])
+		}
+	}, func(i int) {
+		ix.IndexDoc(DocID(i), []string{"x", "y"})
+		if i%3 == 0 {
+			ix.DeleteDoc(DocID(i / 2))
+		}
+		ix.Publish()
+	})
+}
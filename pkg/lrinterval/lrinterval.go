@@ -0,0 +1,250 @@
+package lrinterval
+
+import (
+	"errors"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// ID identifies an interval inserted into a Tree, so it can later be deleted. IDs are never reused.
+type ID uint64
+
+// Interval is a closed interval [Lo, Hi] along with its value.
+type Interval[V any] struct {
+	ID     ID
+	Lo, Hi int64
+	Value  V
+}
+
+// ErrInvalidInterval is returned when inserting an interval whose Lo is larger than its Hi.
+var ErrInvalidInterval = errors.New("lrinterval: lo is larger than hi")
+
+// Tree is an interval tree with values of type V, protected by a LeftRightLock. Insert, Delete and Publish are writes,
+// while Overlapping, Stabbing and Len are reads.
+//
+// It is implemented as an AVL tree ordered by Lo (and ID for equal Lo), where every node also tracks the largest Hi in
+// its subtree, so queries can skip subtrees that end before the queried range.
+type Tree[V any] struct {
+	lr *lock.LeftRightLock
+	// lastID is the ID assigned to the last inserted interval. The writer assigns IDs, so both sides agree on them.
+	lastID ID
+}
+
+// New creates an empty Tree.
+func New[V any]() *Tree[V] {
+	return &Tree[V]{lr: lock.NewLeftRightLock(newIntervals[V](), newIntervals[V]())}
+}
+
+// Insert adds the closed interval [lo, hi] with the given value and returns its ID.
+func (t *Tree[V]) Insert(lo, hi int64, value V) (ID, error) {
+	if lo > hi {
+		return 0, ErrInvalidInterval
+	}
+	t.lastID++
+	t.lr.Write(insertOp[V]{Interval[V]{t.lastID, lo, hi, value}})
+	return t.lastID, nil
+}
+
+// Delete removes the interval with the given ID. Returns true if it was in the tree.
+func (t *Tree[V]) Delete(id ID) bool {
+	return t.lr.Write(deleteOp{id}).(bool)
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (t *Tree[V]) Publish() {
+	t.lr.Publish()
+}
+
+// Len returns the number of intervals in the tree.
+func (t *Tree[V]) Len() int {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	return len(data.(*intervals[V]).byID)
+}
+
+// Overlapping returns all intervals that share at least one point with [lo, hi], ordered by Lo and then by ID.
+func (t *Tree[V]) Overlapping(lo, hi int64) []Interval[V] {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	var res []Interval[V]
+	data.(*intervals[V]).root.overlapping(lo, hi, &res)
+	return res
+}
+
+// Stabbing returns all intervals that contain point, ordered by Lo and then by ID.
+func (t *Tree[V]) Stabbing(point int64) []Interval[V] {
+	return t.Overlapping(point, point)
+}
+
+// node is a single node of the AVL tree.
+type node[V any] struct {
+	iv          Interval[V]
+	left, right *node[V]
+	height      int
+	// maxHi is the largest Hi of all intervals in the subtree rooted at this node.
+	maxHi int64
+}
+
+func (n *node[V]) less(o Interval[V]) bool {
+	if n.iv.Lo != o.Lo {
+		return n.iv.Lo < o.Lo
+	}
+	return n.iv.ID < o.ID
+}
+
+func height[V any](n *node[V]) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// fix recomputes the height and maxHi of n from its children.
+func (n *node[V]) fix() {
+	n.height = 1 + height(n.left)
+	if h := height(n.right); h >= n.height {
+		n.height = 1 + h
+	}
+	n.maxHi = n.iv.Hi
+	if n.left != nil && n.left.maxHi > n.maxHi {
+		n.maxHi = n.left.maxHi
+	}
+	if n.right != nil && n.right.maxHi > n.maxHi {
+		n.maxHi = n.right.maxHi
+	}
+}
+
+func (n *node[V]) rotateLeft() *node[V] {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	n.fix()
+	r.fix()
+	return r
+}
+
+func (n *node[V]) rotateRight() *node[V] {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	n.fix()
+	l.fix()
+	return l
+}
+
+// balance restores the AVL invariant at n, assuming both subtrees are balanced, and returns the new subtree root.
+func (n *node[V]) balance() *node[V] {
+	n.fix()
+	switch bf := height(n.left) - height(n.right); {
+	case bf > 1:
+		if height(n.left.left) < height(n.left.right) {
+			n.left = n.left.rotateLeft()
+		}
+		return n.rotateRight()
+	case bf < -1:
+		if height(n.right.right) < height(n.right.left) {
+			n.right = n.right.rotateRight()
+		}
+		return n.rotateLeft()
+	}
+	return n
+}
+
+func insert[V any](n *node[V], iv Interval[V]) *node[V] {
+	if n == nil {
+		return &node[V]{iv: iv, height: 1, maxHi: iv.Hi}
+	}
+	if n.less(iv) {
+		n.right = insert(n.right, iv)
+	} else {
+		n.left = insert(n.left, iv)
+	}
+	return n.balance()
+}
+
+// removeMin removes the leftmost node of the subtree and returns it along with the new subtree root.
+func removeMin[V any](n *node[V]) (*node[V], *node[V]) {
+	if n.left == nil {
+		return n, n.right
+	}
+	m, left := removeMin(n.left)
+	n.left = left
+	return m, n.balance()
+}
+
+func remove[V any](n *node[V], iv Interval[V]) *node[V] {
+	if n == nil {
+		return nil
+	}
+	switch {
+	case n.iv.ID == iv.ID:
+		if n.left == nil {
+			return n.right
+		}
+		if n.right == nil {
+			return n.left
+		}
+		m, right := removeMin(n.right)
+		m.left, m.right = n.left, right
+		return m.balance()
+	case n.less(iv):
+		n.right = remove(n.right, iv)
+	default:
+		n.left = remove(n.left, iv)
+	}
+	return n.balance()
+}
+
+// overlapping appends all intervals in the subtree that overlap [lo, hi] to res, in order.
+func (n *node[V]) overlapping(lo, hi int64, res *[]Interval[V]) {
+	if n == nil || n.maxHi < lo {
+		return
+	}
+	n.left.overlapping(lo, hi, res)
+	if n.iv.Lo > hi {
+		// Everything to the right starts even later.
+		return
+	}
+	if n.iv.Hi >= lo {
+		*res = append(*res, n.iv)
+	}
+	n.right.overlapping(lo, hi, res)
+}
+
+// intervals is one copy of the tree.
+type intervals[V any] struct {
+	root *node[V]
+	// byID lets us find the position of an interval in the tree when deleting it.
+	byID map[ID]Interval[V]
+}
+
+func newIntervals[V any]() *intervals[V] {
+	return &intervals[V]{byID: make(map[ID]Interval[V])}
+}
+
+type insertOp[V any] struct {
+	iv Interval[V]
+}
+
+type deleteOp struct {
+	id ID
+}
+
+// Update applies a single tree operation.
+func (s *intervals[V]) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case insertOp[V]:
+		s.root = insert(s.root, o.iv)
+		s.byID[o.iv.ID] = o.iv
+		return nil
+	case deleteOp:
+		iv, ok := s.byID[o.id]
+		if !ok {
+			return false
+		}
+		s.root = remove(s.root, iv)
+		delete(s.byID, o.id)
+		return true
+	}
+	panic("lrinterval: unknown operation")
+}
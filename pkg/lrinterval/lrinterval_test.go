@@ -0,0 +1,150 @@
+package lrinterval
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func ids[V any](ivs []Interval[V]) (res []ID) {
+	for _, iv := range ivs {
+		res = append(res, iv.ID)
+	}
+	return
+}
+
+func TestBasic(t *testing.T) {
+	tr := New[string]()
+	a, err := tr.Insert(10, 20, "a")
+	assert.Nil(t, err)
+	b, _ := tr.Insert(15, 25, "b")
+	c, _ := tr.Insert(30, 40, "c")
+	_, err = tr.Insert(5, 1, "bad")
+	assert.Equal(t, ErrInvalidInterval, err)
+
+	assert.Nil(t, tr.Stabbing(15))
+	tr.Publish()
+	assert.Equal(t, 3, tr.Len())
+
+	assert.Equal(t, []ID{a, b}, ids(tr.Stabbing(15)))
+	assert.Equal(t, []ID{a}, ids(tr.Stabbing(10)))
+	assert.Equal(t, []ID{b}, ids(tr.Stabbing(25)))
+	assert.Nil(t, tr.Stabbing(26))
+	assert.Equal(t, []ID{b, c}, ids(tr.Overlapping(21, 30)))
+	assert.Equal(t, []ID{a, b, c}, ids(tr.Overlapping(0, 100)))
+	assert.Nil(t, tr.Overlapping(41, 100))
+
+	iv := tr.Stabbing(35)[0]
+	assert.Equal(t, Interval[string]{c, 30, 40, "c"}, iv)
+
+	assert.True(t, tr.Delete(b))
+	assert.False(t, tr.Delete(b))
+	tr.Publish()
+	assert.Equal(t, []ID{a}, ids(tr.Stabbing(15)))
+	assert.Equal(t, 2, tr.Len())
+}
+
+func TestEqualLo(t *testing.T) {
+	tr := New[int]()
+	var want []ID
+	for i := 0; i < 10; i++ {
+		id, _ := tr.Insert(0, int64(i), i)
+		want = append(want, id)
+	}
+	tr.Publish()
+	assert.Equal(t, want, ids(tr.Stabbing(0)))
+	assert.Equal(t, want[5:], ids(tr.Stabbing(5)))
+
+	tr.Delete(want[3])
+	tr.Publish()
+	assert.Equal(t, append(append([]ID{}, want[:3]...), want[4:]...), ids(tr.Stabbing(0)))
+}
+
+// checkBalanced verifies the AVL and maxHi invariants and returns the height of the subtree.
+func checkBalanced[V any](t *testing.T, n *node[V]) int {
+	if n == nil {
+		return 0
+	}
+	l, r := checkBalanced(t, n.left), checkBalanced(t, n.right)
+	assert.LessOrEqual(t, l-r, 1)
+	assert.LessOrEqual(t, r-l, 1)
+	maxHi := n.iv.Hi
+	if n.left != nil && n.left.maxHi > maxHi {
+		maxHi = n.left.maxHi
+	}
+	if n.right != nil && n.right.maxHi > maxHi {
+		maxHi = n.right.maxHi
+	}
+	assert.Equal(t, maxHi, n.maxHi)
+	if l > r {
+		return l + 1
+	}
+	return r + 1
+}
+
+func TestRandomAgainstNaive(t *testing.T) {
+	tr := New[int]()
+	ref := make(map[ID]Interval[int])
+	for i := 0; i < 3000; i++ {
+		if rand.Intn(3) == 0 && len(ref) > 0 {
+			for id := range ref {
+				assert.True(t, tr.Delete(id))
+				delete(ref, id)
+				break
+			}
+		} else {
+			lo := rand.Int63n(1000)
+			hi := lo + rand.Int63n(50)
+			id, _ := tr.Insert(lo, hi, i)
+			ref[id] = Interval[int]{id, lo, hi, i}
+		}
+		if i%100 == 0 {
+			tr.Publish()
+		}
+	}
+	// Check both sides.
+	for s := 0; s < 2; s++ {
+		tr.Publish()
+		data, art := tr.lr.RLock()
+		checkBalanced(t, data.(*intervals[int]).root)
+		tr.lr.RUnlock(art)
+
+		for q := 0; q < 200; q++ {
+			lo := rand.Int63n(1100)
+			hi := lo + rand.Int63n(20)
+			var want []Interval[int]
+			for _, iv := range ref {
+				if iv.Lo <= hi && iv.Hi >= lo {
+					want = append(want, iv)
+				}
+			}
+			sort.Slice(want, func(i, j int) bool {
+				if want[i].Lo != want[j].Lo {
+					return want[i].Lo < want[j].Lo
+				}
+				return want[i].ID < want[j].ID
+			})
+			assert.Equal(t, want, tr.Overlapping(lo, hi))
+		}
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	tr := New[string]()
+	tr.Insert(0, 100, "always")
+	tr.Publish()
+	lrtest.ConcurrentReaders(500, func(int) {
+		res := tr.Stabbing(50)
+		assert.NotEmpty(t, res)
+		assert.Equal(t, "always", res[0].Value)
+	}, func(i int) {
+		id, _ := tr.Insert(int64(i%100), 100, "temporary")
+		tr.Publish()
+		tr.Delete(id)
+		tr.Publish()
+	})
+}
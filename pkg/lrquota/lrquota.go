@@ -0,0 +1,255 @@
+package lrquota
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// DefaultTier is the tier used for keys that were never assigned a tier or a limit.
+const DefaultTier = "default"
+
+// Limit is a token bucket configuration. The bucket holds at most Burst tokens and refills at Rate tokens per second.
+// A non-positive or NaN Rate denies everything and an infinite Rate allows everything. A Rate so small that a single
+// token takes longer than about 292 years to refill denies everything as well, and refill times beyond the year 2262
+// are capped there.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Options configure a Table.
+type Options struct {
+	// Now returns the current time. Defaults to time.Now and is only overridden in tests.
+	Now func() time.Time
+}
+
+// Table holds per-key quota configuration protected by a LeftRightLock. SetTier, DeleteTier, Assign, SetLimit, Remove
+// and Publish are writes, meant to be batched into bulk plan changes that are published at once. Lookup, Allow, AllowN
+// and Sweep can be called from any go routine on every request.
+//
+// Every key is limited by its own Limit if one was set, otherwise by the limit of its tier, otherwise by the limit of
+// DefaultTier. Keys that resolve to no limit at all are not limited.
+//
+// The configuration is read through the lock, while the token buckets themselves live outside of it, as one atomic
+// counter per key shared by all reading go routines. A bucket is created the first time a key is limited and evicted
+// by Sweep once it has refilled completely, since a full bucket is the same as no bucket at all. This keeps memory
+// proportional to the keys that were limited within roughly the last burst period, rather than all keys ever seen.
+type Table struct {
+	lr   *lock.LeftRightLock
+	opts Options
+	// buckets maps keys to *int64 holding the theoretical arrival time of the next request in unix nanoseconds, as
+	// used by the generic cell rate algorithm, which is equivalent to a token bucket but needs just a single word of
+	// state. Evicted buckets hold the evicted sentinel.
+	buckets sync.Map
+}
+
+// evicted marks a bucket that was removed from buckets by Sweep. Readers that still hold it look the key up again.
+const evicted = math.MaxInt64
+
+// New creates an empty Table.
+func New(opts Options) *Table {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Table{lr: lock.NewLeftRightLock(newConfig(), newConfig()), opts: opts}
+}
+
+// SetTier creates or replaces a named tier.
+func (t *Table) SetTier(tier string, limit Limit) {
+	t.lr.Write(setTierOp{tier, limit})
+}
+
+// DeleteTier removes a named tier. Keys assigned to it fall back to DefaultTier. Returns true if it existed.
+func (t *Table) DeleteTier(tier string) bool {
+	return t.lr.Write(deleteTierOp{tier}).(bool)
+}
+
+// Assign puts the key into the given tier and drops any limit set for the key itself.
+func (t *Table) Assign(key, tier string) {
+	t.lr.Write(setKeyOp{key, assignment{tier: tier}})
+}
+
+// SetLimit sets a limit for the key itself, overriding its tier.
+func (t *Table) SetLimit(key string, limit Limit) {
+	t.lr.Write(setKeyOp{key, assignment{limit: limit, hasLimit: true}})
+}
+
+// Remove drops the tier assignment and the limit of the key, along with its token bucket. Returns true if the key had
+// any configuration.
+func (t *Table) Remove(key string) bool {
+	if tat, ok := t.buckets.Load(key); ok {
+		atomic.StoreInt64(tat.(*int64), evicted)
+		t.buckets.Delete(key)
+	}
+	return t.lr.Write(removeKeyOp{key}).(bool)
+}
+
+// Publish makes all the writes since the last Publish visible to readers and sweeps full buckets.
+func (t *Table) Publish() {
+	t.lr.Publish()
+	t.Sweep()
+}
+
+// Sweep evicts the buckets of all keys that have refilled completely. It is called by Publish, but should also be
+// called periodically if the configuration is rarely published. Returns the number of evicted buckets.
+func (t *Table) Sweep() int {
+	now := t.opts.Now().UnixNano()
+	n := 0
+	t.buckets.Range(func(key, value interface{}) bool {
+		tat := value.(*int64)
+		// The CAS makes sure no reader took a token between the check and the eviction.
+		if old := atomic.LoadInt64(tat); old <= now && atomic.CompareAndSwapInt64(tat, old, evicted) {
+			t.buckets.Delete(key)
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// Lookup returns the limit that currently applies to the key. Returns false if the key is not limited.
+func (t *Table) Lookup(key string) (Limit, bool) {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	return data.(*config).resolve(key)
+}
+
+// Allow reports whether a single request for the key is allowed right now, and takes a token if it is.
+func (t *Table) Allow(key string) bool {
+	return t.AllowN(key, 1)
+}
+
+// AllowN reports whether n requests for the key are allowed right now, and takes n tokens if they are. Either all or
+// none of the tokens are taken. A negative n is never allowed, so it can't be used to refund tokens.
+func (t *Table) AllowN(key string, n int) bool {
+	if n < 0 {
+		return false
+	}
+	limit, ok := t.Lookup(key)
+	switch {
+	case !ok || math.IsInf(limit.Rate, 1) || n == 0:
+		return true
+	case !(limit.Rate > 0) || n > limit.Burst:
+		// This also catches a NaN rate.
+		return false
+	}
+	now := t.opts.Now().UnixNano()
+	interval := float64(time.Second) / limit.Rate
+	// Compute in float64 first, so tiny rates and huge bursts don't silently overflow int64 nanoseconds. If even a
+	// single token can't be represented, deny. Otherwise cap the increment and the tolerance, so that the next arrival
+	// time stays below evicted. Since n <= Burst, the increment never exceeds the tolerance.
+	if interval >= math.MaxInt64 {
+		return false
+	}
+	limitNs := evicted - 1 - now
+	increment, tolerance := limitNs, limitNs
+	if inc := interval * float64(n); inc < float64(limitNs) {
+		increment = int64(inc)
+	}
+	if tol := interval * float64(limit.Burst); tol < float64(limitNs) {
+		tolerance = int64(tol)
+	}
+
+	tat := t.bucket(key)
+	for {
+		old := atomic.LoadInt64(tat)
+		if old == evicted {
+			tat = t.bucket(key)
+			continue
+		}
+		var wait int64
+		if old > now {
+			wait = old - now
+		}
+		// Same as wait+increment > tolerance, without overflowing.
+		if increment > tolerance-wait {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(tat, old, now+wait+increment) {
+			return true
+		}
+	}
+}
+
+// bucket returns the atomic state of the key's token bucket, creating a full bucket if needed.
+func (t *Table) bucket(key string) *int64 {
+	if tat, ok := t.buckets.Load(key); ok {
+		return tat.(*int64)
+	}
+	tat, _ := t.buckets.LoadOrStore(key, new(int64))
+	return tat.(*int64)
+}
+
+// assignment is the configuration of a single key.
+type assignment struct {
+	tier     string
+	limit    Limit
+	hasLimit bool
+}
+
+// config is one copy of the tiers and key assignments.
+type config struct {
+	tiers map[string]Limit
+	keys  map[string]assignment
+}
+
+func newConfig() *config {
+	return &config{tiers: make(map[string]Limit), keys: make(map[string]assignment)}
+}
+
+func (c *config) resolve(key string) (Limit, bool) {
+	a, ok := c.keys[key]
+	if ok && a.hasLimit {
+		return a.limit, true
+	}
+	if ok {
+		if limit, ok := c.tiers[a.tier]; ok {
+			return limit, true
+		}
+	}
+	limit, ok := c.tiers[DefaultTier]
+	return limit, ok
+}
+
+type setTierOp struct {
+	tier  string
+	limit Limit
+}
+
+type deleteTierOp struct {
+	tier string
+}
+
+type setKeyOp struct {
+	key string
+	a   assignment
+}
+
+type removeKeyOp struct {
+	key string
+}
+
+// Update applies a single configuration change.
+func (c *config) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case setTierOp:
+		c.tiers[o.tier] = o.limit
+		return nil
+	case deleteTierOp:
+		_, ok := c.tiers[o.tier]
+		delete(c.tiers, o.tier)
+		return ok
+	case setKeyOp:
+		c.keys[o.key] = o.a
+		return nil
+	case removeKeyOp:
+		_, ok := c.keys[o.key]
+		delete(c.keys, o.key)
+		return ok
+	}
+	panic("lrquota: unknown operation")
+}
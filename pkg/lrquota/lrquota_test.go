@@ -0,0 +1,202 @@
+package lrquota
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+var t0 = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestResolve(t *testing.T) {
+	tb := New(Options{})
+	tb.SetTier(DefaultTier, Limit{1, 1})
+	tb.SetTier("gold", Limit{100, 10})
+	tb.Assign("alice", "gold")
+	tb.SetLimit("bob", Limit{5, 2})
+	tb.Assign("carol", "missing")
+	_, ok := tb.Lookup("alice")
+	assert.False(t, ok)
+
+	tb.Publish()
+	l, ok := tb.Lookup("alice")
+	assert.True(t, ok)
+	assert.Equal(t, Limit{100, 10}, l)
+	l, _ = tb.Lookup("bob")
+	assert.Equal(t, Limit{5, 2}, l)
+	// Unknown tiers and unknown keys fall back to the default tier.
+	l, _ = tb.Lookup("carol")
+	assert.Equal(t, Limit{1, 1}, l)
+	l, _ = tb.Lookup("dave")
+	assert.Equal(t, Limit{1, 1}, l)
+
+	assert.True(t, tb.DeleteTier("gold"))
+	assert.False(t, tb.DeleteTier("gold"))
+	assert.True(t, tb.Remove("bob"))
+	assert.False(t, tb.Remove("bob"))
+	assert.True(t, tb.DeleteTier(DefaultTier))
+	tb.Publish()
+	_, ok = tb.Lookup("alice")
+	assert.False(t, ok)
+	_, ok = tb.Lookup("bob")
+	assert.False(t, ok)
+	assert.True(t, tb.Allow("bob"))
+
+	// Check the other side as well.
+	tb.Publish()
+	_, ok = tb.Lookup("alice")
+	assert.False(t, ok)
+}
+
+func TestAllow(t *testing.T) {
+	now := t0
+	tb := New(Options{Now: func() time.Time { return now }})
+	tb.SetLimit("k", Limit{Rate: 10, Burst: 3})
+	tb.SetLimit("none", Limit{Rate: 0, Burst: 3})
+	tb.SetLimit("all", Limit{Rate: math.Inf(1)})
+	tb.Publish()
+
+	// A fresh bucket is full.
+	assert.True(t, tb.Allow("k"))
+	assert.True(t, tb.AllowN("k", 2))
+	assert.False(t, tb.Allow("k"))
+
+	// Tokens refill at Rate per second.
+	now = now.Add(100 * time.Millisecond)
+	assert.True(t, tb.Allow("k"))
+	assert.False(t, tb.Allow("k"))
+
+	// Requests are all-or-nothing and can't exceed the burst.
+	now = now.Add(200 * time.Millisecond)
+	assert.False(t, tb.AllowN("k", 3))
+	assert.True(t, tb.AllowN("k", 2))
+	now = now.Add(time.Hour)
+	assert.False(t, tb.AllowN("k", 4))
+	assert.True(t, tb.AllowN("k", 3))
+
+	assert.False(t, tb.Allow("none"))
+	for i := 0; i < 100; i++ {
+		assert.True(t, tb.Allow("all"))
+	}
+
+	// Raising the limit applies to the existing bucket.
+	tb.SetLimit("k", Limit{Rate: 10, Burst: 5})
+	tb.Publish()
+	assert.True(t, tb.AllowN("k", 2))
+}
+
+func TestInvalidRequests(t *testing.T) {
+	tb := New(Options{Now: func() time.Time { return t0 }})
+	tb.SetLimit("k", Limit{Rate: 1, Burst: 1})
+	tb.SetLimit("nan", Limit{Rate: math.NaN(), Burst: 10})
+	tb.Publish()
+
+	assert.True(t, tb.Allow("k"))
+	assert.False(t, tb.Allow("k"))
+	// A negative n must not refund tokens.
+	assert.False(t, tb.AllowN("k", -5))
+	assert.False(t, tb.Allow("k"))
+	// Asking for nothing is always allowed.
+	assert.True(t, tb.AllowN("k", 0))
+	assert.False(t, tb.Allow("nan"))
+}
+
+func TestExtremeLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		n     int
+		allow []bool
+	}{
+		// A single token would take longer to refill than int64 nanoseconds can hold.
+		{"tiny rate", Limit{Rate: 1e-12, Burst: 1}, 1, []bool{false, false, false}},
+		{"slow rate", Limit{Rate: 1e-9, Burst: 2}, 1, []bool{true, true, false}},
+		// Both the request and the burst take longer than int64 nanoseconds can hold, so they are capped to the same
+		// time and the first request drains the bucket.
+		{"slow rate large n", Limit{Rate: 1e-9, Burst: 100}, 50, []bool{true, false}},
+		// The burst spans more time than int64 nanoseconds can hold.
+		{"huge burst", Limit{Rate: 1, Burst: 1 << 40}, 5, []bool{true, true, true}},
+		{"huge burst all at once", Limit{Rate: 1, Burst: 1 << 40}, 1 << 40, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := New(Options{Now: func() time.Time { return t0 }})
+			tb.SetLimit("k", tt.limit)
+			tb.Publish()
+			for i, want := range tt.allow {
+				assert.Equal(t, want, tb.AllowN("k", tt.n), i)
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := t0
+	tb := New(Options{Now: func() time.Time { return now }})
+	tb.SetTier(DefaultTier, Limit{Rate: 10, Burst: 2})
+	tb.Publish()
+	for i := 0; i < 100; i++ {
+		tb.Allow(string(rune('A' + i%26)))
+	}
+	assert.True(t, tb.AllowN("x", 2))
+	assert.False(t, tb.Allow("x"))
+	// Nothing has refilled yet.
+	assert.Equal(t, 0, tb.Sweep())
+
+	// Buckets that have refilled completely are dropped and start out full again.
+	now = now.Add(200 * time.Millisecond)
+	assert.Equal(t, 27, tb.Sweep())
+	assert.Equal(t, 0, tb.Sweep())
+	assert.True(t, tb.AllowN("x", 2))
+	assert.False(t, tb.Allow("x"))
+
+	// A reader holding on to an evicted bucket starts over with the new one.
+	now = now.Add(time.Second)
+	tat := tb.bucket("y")
+	assert.Equal(t, 2, tb.Sweep())
+	assert.Equal(t, int64(evicted), atomic.LoadInt64(tat))
+	assert.True(t, tb.Allow("y"))
+	assert.NotSame(t, tat, tb.bucket("y"))
+}
+
+func TestConcurrentAllow(t *testing.T) {
+	tb := New(Options{Now: func() time.Time { return t0 }})
+	tb.SetLimit("k", Limit{Rate: 1, Burst: 100})
+	tb.Publish()
+	var wg sync.WaitGroup
+	var allowed int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if tb.Allow("k") {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// The clock doesn't move, so exactly the burst gets through.
+	assert.Equal(t, int64(100), allowed)
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	tb := New(Options{})
+	lrtest.ConcurrentReaders(500, func(int) {
+		// Burst is always set to ten times the rate.
+		if l, ok := tb.Lookup("k"); ok {
+			assert.Equal(t, float64(l.Burst), 10*l.Rate)
+		}
+		tb.Allow("k")
+	}, func(i int) {
+		tb.SetTier(DefaultTier, Limit{float64(i + 1), 10 * (i + 1)})
+		tb.Publish()
+	})
+}
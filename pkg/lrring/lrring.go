@@ -0,0 +1,137 @@
+package lrring
+
+import (
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// Entry is an item along with its sequence number. Sequence numbers start at 1 and increase by one with every Push.
+type Entry[T any] struct {
+	Seq  uint64
+	Item T
+}
+
+// Ring is a fixed-capacity ring of the most recent items of type T, protected by a LeftRightLock. Push and Publish are
+// writes, all the other methods are reads. Once the ring is full, every Push overwrites the oldest item.
+type Ring[T any] struct {
+	lr *lock.LeftRightLock
+	// lastSeq is the sequence number of the last pushed item.
+	lastSeq uint64
+}
+
+// New creates an empty Ring holding at most capacity items.
+func New[T any](capacity int) *Ring[T] {
+	if capacity <= 0 {
+		panic("lrring: capacity must be positive")
+	}
+	return &Ring[T]{lr: lock.NewLeftRightLock(newRing[T](capacity), newRing[T](capacity))}
+}
+
+// Push appends an item, overwriting the oldest one if the ring is full, and returns its sequence number.
+func (r *Ring[T]) Push(item T) uint64 {
+	r.lastSeq++
+	r.lr.Write(Entry[T]{r.lastSeq, item})
+	return r.lastSeq
+}
+
+// Publish makes all the items pushed since the last Publish visible to readers.
+func (r *Ring[T]) Publish() {
+	r.lr.Publish()
+}
+
+// Len returns the number of items in the ring.
+func (r *Ring[T]) Len() int {
+	data, art := r.lr.RLock()
+	defer r.lr.RUnlock(art)
+	return data.(*ring[T]).len()
+}
+
+// LastSeq returns the sequence number of the newest item, or zero if nothing was published yet.
+func (r *Ring[T]) LastSeq() uint64 {
+	data, art := r.lr.RLock()
+	defer r.lr.RUnlock(art)
+	return data.(*ring[T]).lastSeq
+}
+
+// Last returns up to n newest entries, from oldest to newest.
+func (r *Ring[T]) Last(n int) []Entry[T] {
+	data, art := r.lr.RLock()
+	defer r.lr.RUnlock(art)
+	rg := data.(*ring[T])
+	if n > rg.len() {
+		n = rg.len()
+	}
+	if n <= 0 {
+		return nil
+	}
+	return rg.copyFrom(rg.lastSeq - uint64(n) + 1)
+}
+
+// Since returns all entries with a sequence number larger than seq, from oldest to newest. If some of those entries
+// were already overwritten, it returns all the entries that are still in the ring, which readers can detect by
+// checking whether the first returned sequence number is seq+1.
+func (r *Ring[T]) Since(seq uint64) []Entry[T] {
+	data, art := r.lr.RLock()
+	defer r.lr.RUnlock(art)
+	rg := data.(*ring[T])
+	if seq >= rg.lastSeq {
+		return nil
+	}
+	if oldest := rg.oldestSeq(); seq < oldest {
+		seq = oldest - 1
+	}
+	return rg.copyFrom(seq + 1)
+}
+
+// Iter calls fn for every entry from oldest to newest, until fn returns false.
+func (r *Ring[T]) Iter(fn func(Entry[T]) bool) {
+	data, art := r.lr.RLock()
+	defer r.lr.RUnlock(art)
+	rg := data.(*ring[T])
+	for seq := rg.oldestSeq(); seq <= rg.lastSeq; seq++ {
+		if !fn(rg.buf[seq%uint64(len(rg.buf))]) {
+			return
+		}
+	}
+}
+
+// ring is one copy of the ring. The entry with sequence number s is stored at index s % len(buf).
+type ring[T any] struct {
+	buf     []Entry[T]
+	lastSeq uint64
+}
+
+func newRing[T any](capacity int) *ring[T] {
+	return &ring[T]{buf: make([]Entry[T], capacity)}
+}
+
+func (rg *ring[T]) len() int {
+	if rg.lastSeq < uint64(len(rg.buf)) {
+		return int(rg.lastSeq)
+	}
+	return len(rg.buf)
+}
+
+func (rg *ring[T]) oldestSeq() uint64 {
+	return rg.lastSeq - uint64(rg.len()) + 1
+}
+
+// copyFrom returns a copy of all entries starting with the given sequence number, which must be in the ring.
+func (rg *ring[T]) copyFrom(seq uint64) []Entry[T] {
+	res := make([]Entry[T], 0, rg.lastSeq-seq+1)
+	start := int(seq % uint64(len(rg.buf)))
+	end := int(rg.lastSeq%uint64(len(rg.buf))) + 1
+	if start < end {
+		return append(res, rg.buf[start:end]...)
+	}
+	// The range wraps around the end of the buffer.
+	res = append(res, rg.buf[start:]...)
+	return append(res, rg.buf[:end]...)
+}
+
+// Update stores a pushed entry.
+func (rg *ring[T]) Update(op lock.Operation) lock.OpResult {
+	e := op.(Entry[T])
+	rg.buf[e.Seq%uint64(len(rg.buf))] = e
+	rg.lastSeq = e.Seq
+	return e.Seq
+}
@@ -0,0 +1,87 @@
+package lrring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func seqs[T any](entries []Entry[T]) (res []uint64) {
+	for _, e := range entries {
+		res = append(res, e.Seq)
+	}
+	return
+}
+
+func TestBasic(t *testing.T) {
+	r := New[string](4)
+	assert.Nil(t, r.Last(3))
+	assert.Equal(t, uint64(1), r.Push("a"))
+	assert.Equal(t, uint64(2), r.Push("b"))
+	assert.Equal(t, 0, r.Len())
+
+	r.Publish()
+	assert.Equal(t, 2, r.Len())
+	assert.Equal(t, uint64(2), r.LastSeq())
+	assert.Equal(t, []Entry[string]{{1, "a"}, {2, "b"}}, r.Last(10))
+	assert.Equal(t, []Entry[string]{{2, "b"}}, r.Last(1))
+	assert.Nil(t, r.Last(0))
+	assert.Equal(t, []Entry[string]{{2, "b"}}, r.Since(1))
+	assert.Nil(t, r.Since(2))
+}
+
+func TestWrapAround(t *testing.T) {
+	r := New[int](3)
+	for i := 1; i <= 7; i++ {
+		r.Push(i)
+	}
+	r.Publish()
+	assert.Equal(t, 3, r.Len())
+	assert.Equal(t, []Entry[int]{{5, 5}, {6, 6}, {7, 7}}, r.Last(5))
+	assert.Equal(t, []uint64{6, 7}, seqs(r.Last(2)))
+	assert.Equal(t, []uint64{7}, seqs(r.Since(6)))
+	// Entries 2 to 4 were overwritten, so we get what's left.
+	assert.Equal(t, []uint64{5, 6, 7}, seqs(r.Since(1)))
+	assert.Equal(t, []uint64{5, 6, 7}, seqs(r.Since(0)))
+
+	var got []uint64
+	r.Iter(func(e Entry[int]) bool {
+		got = append(got, e.Seq)
+		return true
+	})
+	assert.Equal(t, []uint64{5, 6, 7}, got)
+
+	got = nil
+	r.Iter(func(e Entry[int]) bool {
+		got = append(got, e.Seq)
+		return false
+	})
+	assert.Equal(t, []uint64{5}, got)
+
+	// Check the other side as well.
+	r.Publish()
+	assert.Equal(t, []Entry[int]{{5, 5}, {6, 6}, {7, 7}}, r.Last(3))
+}
+
+func TestInvalidCapacity(t *testing.T) {
+	assert.Panics(t, func() { New[int](0) })
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	r := New[int](16)
+	var last [lrtest.Readers]uint64
+	lrtest.ConcurrentReaders(1000, func(reader int) {
+		for _, e := range r.Since(last[reader]) {
+			assert.Greater(t, e.Seq, last[reader])
+			assert.Equal(t, int(e.Seq), e.Item)
+			last[reader] = e.Seq
+		}
+	}, func(i int) {
+		r.Push(i + 1)
+		if (i+1)%5 == 0 {
+			r.Publish()
+		}
+	})
+}
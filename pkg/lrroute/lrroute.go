@@ -0,0 +1,255 @@
+package lrroute
+
+import (
+	"errors"
+	"net/netip"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// ErrInvalidPrefix is returned when adding a prefix that is not valid, e.g. the zero netip.Prefix.
+var ErrInvalidPrefix = errors.New("lrroute: invalid prefix")
+
+// Table is an IPv4/IPv6 routing table with values of type V, protected by a LeftRightLock. Add, Remove and Publish are
+// writes, while Lookup, LookupPrefix and Len are reads.
+type Table[V any] struct {
+	lr *lock.LeftRightLock
+}
+
+// New creates an empty Table.
+func New[V any]() *Table[V] {
+	return &Table[V]{lr: lock.NewLeftRightLock(&routes[V]{}, &routes[V]{})}
+}
+
+// normalize masks the host bits of prefix and turns IPv4-mapped IPv6 prefixes into IPv4 ones, since lookups unmap
+// addresses as well. Returns false if the prefix is not valid.
+func normalize(prefix netip.Prefix) (netip.Prefix, bool) {
+	if !prefix.IsValid() {
+		return netip.Prefix{}, false
+	}
+	prefix = prefix.Masked()
+	// Only prefixes of at least 96 bits can be IPv4-mapped after masking, as shorter ones clear the ::ffff: part.
+	if prefix.Addr().Is4In6() {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix, true
+}
+
+// Add sets the value for prefix, replacing any previous value. Host bits of the prefix are ignored, so 10.1.2.3/8 is
+// the same as 10.0.0.0/8, and IPv4-mapped IPv6 prefixes are stored as IPv4 ones, so ::ffff:10.0.0.0/104 is the same as
+// 10.0.0.0/8 too.
+func (t *Table[V]) Add(prefix netip.Prefix, value V) error {
+	prefix, ok := normalize(prefix)
+	if !ok {
+		return ErrInvalidPrefix
+	}
+	t.lr.Write(addOp[V]{prefix, value})
+	return nil
+}
+
+// Remove deletes the route for the given prefix, normalized the same way as in Add. Returns true if it was in the
+// table.
+func (t *Table[V]) Remove(prefix netip.Prefix) bool {
+	prefix, ok := normalize(prefix)
+	if !ok {
+		return false
+	}
+	return t.lr.Write(removeOp{prefix}).(bool)
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (t *Table[V]) Publish() {
+	t.lr.Publish()
+}
+
+// Lookup returns the value of the longest prefix containing addr. IPv4-mapped IPv6 addresses are matched against IPv4
+// prefixes.
+func (t *Table[V]) Lookup(addr netip.Addr) (V, bool) {
+	_, v, ok := t.LookupPrefix(addr)
+	return v, ok
+}
+
+// LookupPrefix is like Lookup, but also returns the matched prefix.
+func (t *Table[V]) LookupPrefix(addr netip.Addr) (netip.Prefix, V, bool) {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	n := data.(*routes[V]).lookup(addr.Unmap().WithZone(""))
+	if n == nil {
+		var zero V
+		return netip.Prefix{}, zero, false
+	}
+	return n.prefix, n.value, true
+}
+
+// Len returns the number of routes in the table.
+func (t *Table[V]) Len() int {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	return data.(*routes[V]).size
+}
+
+// node is a single node of a path compressed binary trie. Its prefix contains the prefixes of all its descendants and
+// the children are split on the first bit after the prefix. Nodes without a value only exist as branching points.
+type node[V any] struct {
+	prefix   netip.Prefix
+	children [2]*node[V]
+	value    V
+	hasValue bool
+}
+
+// bitAt returns the i-th most significant bit of addr.
+func bitAt(addr netip.Addr, i int) int {
+	if addr.Is4() {
+		b := addr.As4()
+		return int(b[i/8]>>(7-i%8)) & 1
+	}
+	b := addr.As16()
+	return int(b[i/8]>>(7-i%8)) & 1
+}
+
+// commonBits returns the length of the common prefix of two addresses from the same family.
+func commonBits(a, b netip.Addr) int {
+	n := 0
+	for n < a.BitLen() && bitAt(a, n) == bitAt(b, n) {
+		n++
+	}
+	return n
+}
+
+// contains returns true if prefix p strictly contains the (longer) prefix q.
+func contains(p, q netip.Prefix) bool {
+	return p.Bits() < q.Bits() && p.Contains(q.Addr())
+}
+
+// compact returns what should take the place of n once it holds no value: n itself if it still branches, its only
+// child, or nothing.
+func (n *node[V]) compact() *node[V] {
+	if n.hasValue {
+		return n
+	}
+	switch {
+	case n.children[0] != nil && n.children[1] != nil:
+		return n
+	case n.children[0] != nil:
+		return n.children[0]
+	default:
+		return n.children[1]
+	}
+}
+
+// routes is one copy of the table. It keeps a separate trie for each address family.
+type routes[V any] struct {
+	v4   *node[V]
+	v6   *node[V]
+	size int
+}
+
+func (r *routes[V]) root(addr netip.Addr) **node[V] {
+	if addr.Is4() {
+		return &r.v4
+	}
+	return &r.v6
+}
+
+func (r *routes[V]) lookup(addr netip.Addr) *node[V] {
+	var best *node[V]
+	for n := *r.root(addr); n != nil && n.prefix.Contains(addr); {
+		if n.hasValue {
+			best = n
+		}
+		if n.prefix.Bits() == addr.BitLen() {
+			break
+		}
+		n = n.children[bitAt(addr, n.prefix.Bits())]
+	}
+	return best
+}
+
+// insert adds a route into the subtree rooted at n and returns the new root of that subtree.
+func (r *routes[V]) insert(n *node[V], prefix netip.Prefix, value V) *node[V] {
+	if n == nil {
+		r.size++
+		return &node[V]{prefix: prefix, value: value, hasValue: true}
+	}
+	if n.prefix == prefix {
+		if !n.hasValue {
+			r.size++
+		}
+		n.value = value
+		n.hasValue = true
+		return n
+	}
+	if contains(n.prefix, prefix) {
+		b := bitAt(prefix.Addr(), n.prefix.Bits())
+		n.children[b] = r.insert(n.children[b], prefix, value)
+		return n
+	}
+	// The new prefix branches off somewhere above n, so we need a new node at the branching point.
+	bits := commonBits(n.prefix.Addr(), prefix.Addr())
+	if n.prefix.Bits() < bits {
+		bits = n.prefix.Bits()
+	}
+	if prefix.Bits() < bits {
+		bits = prefix.Bits()
+	}
+	branch := &node[V]{prefix: netip.PrefixFrom(prefix.Addr(), bits).Masked()}
+	if bits == prefix.Bits() {
+		// The new prefix contains n, so it becomes its parent.
+		branch.value = value
+		branch.hasValue = true
+		r.size++
+	} else {
+		branch.children[bitAt(prefix.Addr(), bits)] = r.insert(nil, prefix, value)
+	}
+	branch.children[bitAt(n.prefix.Addr(), bits)] = n
+	return branch
+}
+
+// remove deletes the route for prefix from the subtree rooted at n and returns the new root of that subtree.
+func (r *routes[V]) remove(n *node[V], prefix netip.Prefix) (*node[V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	if n.prefix == prefix {
+		if !n.hasValue {
+			return n, false
+		}
+		var zero V
+		n.value = zero
+		n.hasValue = false
+		r.size--
+		return n.compact(), true
+	}
+	if !contains(n.prefix, prefix) {
+		return n, false
+	}
+	b := bitAt(prefix.Addr(), n.prefix.Bits())
+	child, ok := r.remove(n.children[b], prefix)
+	n.children[b] = child
+	return n.compact(), ok
+}
+
+type addOp[V any] struct {
+	prefix netip.Prefix
+	value  V
+}
+
+type removeOp struct {
+	prefix netip.Prefix
+}
+
+// Update applies a single routing table operation.
+func (r *routes[V]) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case addOp[V]:
+		root := r.root(o.prefix.Addr())
+		*root = r.insert(*root, o.prefix, o.value)
+		return nil
+	case removeOp:
+		root := r.root(o.prefix.Addr())
+		var ok bool
+		*root, ok = r.remove(*root, o.prefix)
+		return ok
+	}
+	panic("lrroute: unknown operation")
+}
@@ -0,0 +1,164 @@
+package lrroute
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func lookup(t *Table[string], addr string) string {
+	v, _ := t.Lookup(netip.MustParseAddr(addr))
+	return v
+}
+
+func TestBasic(t *testing.T) {
+	tbl := New[string]()
+	assert.Nil(t, tbl.Add(netip.MustParsePrefix("10.0.0.0/8"), "ten"))
+	assert.Nil(t, tbl.Add(netip.MustParsePrefix("10.1.0.0/16"), "ten-one"))
+	assert.Nil(t, tbl.Add(netip.MustParsePrefix("10.1.2.3/32"), "host"))
+	assert.Nil(t, tbl.Add(netip.MustParsePrefix("0.0.0.0/0"), "default"))
+	assert.Equal(t, ErrInvalidPrefix, tbl.Add(netip.Prefix{}, "bad"))
+
+	assert.Empty(t, lookup(tbl, "10.1.2.3"))
+	tbl.Publish()
+	assert.Equal(t, 4, tbl.Len())
+
+	assert.Equal(t, "host", lookup(tbl, "10.1.2.3"))
+	assert.Equal(t, "ten-one", lookup(tbl, "10.1.2.4"))
+	assert.Equal(t, "ten", lookup(tbl, "10.2.0.1"))
+	assert.Equal(t, "default", lookup(tbl, "192.168.0.1"))
+	// IPv4-mapped IPv6 addresses match IPv4 routes.
+	assert.Equal(t, "host", lookup(tbl, "::ffff:10.1.2.3"))
+	// IPv6 addresses don't match IPv4 routes.
+	assert.Empty(t, lookup(tbl, "2001:db8::1"))
+
+	p, v, ok := tbl.LookupPrefix(netip.MustParseAddr("10.1.9.9"))
+	assert.True(t, ok)
+	assert.Equal(t, netip.MustParsePrefix("10.1.0.0/16"), p)
+	assert.Equal(t, "ten-one", v)
+
+	assert.True(t, tbl.Remove(netip.MustParsePrefix("10.1.0.0/16")))
+	assert.False(t, tbl.Remove(netip.MustParsePrefix("10.1.0.0/16")))
+	assert.False(t, tbl.Remove(netip.MustParsePrefix("10.1.0.0/17")))
+	tbl.Publish()
+	assert.Equal(t, "ten", lookup(tbl, "10.1.2.4"))
+	assert.Equal(t, "host", lookup(tbl, "10.1.2.3"))
+	assert.Equal(t, 3, tbl.Len())
+}
+
+func TestHostBitsIgnored(t *testing.T) {
+	tbl := New[string]()
+	tbl.Add(netip.MustParsePrefix("10.1.2.3/8"), "ten")
+	tbl.Publish()
+	p, _, ok := tbl.LookupPrefix(netip.MustParseAddr("10.200.0.1"))
+	assert.True(t, ok)
+	assert.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), p)
+	assert.True(t, tbl.Remove(netip.MustParsePrefix("10.9.9.9/8")))
+}
+
+func TestIPv4MappedPrefix(t *testing.T) {
+	tbl := New[string]()
+	assert.Nil(t, tbl.Add(netip.MustParsePrefix("::ffff:10.0.0.0/104"), "mapped"))
+	// A prefix that covers more than the mapped range stays an IPv6 one.
+	assert.Nil(t, tbl.Add(netip.MustParsePrefix("::/80"), "v6"))
+	tbl.Publish()
+	assert.Equal(t, 2, tbl.Len())
+
+	p, v, ok := tbl.LookupPrefix(netip.MustParseAddr("10.1.2.3"))
+	assert.True(t, ok)
+	assert.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), p)
+	assert.Equal(t, "mapped", v)
+	assert.Equal(t, "mapped", lookup(tbl, "::ffff:10.1.2.3"))
+	assert.Equal(t, "v6", lookup(tbl, "::1"))
+
+	// The mapped and plain forms name the same route.
+	assert.Nil(t, tbl.Add(netip.MustParsePrefix("10.0.0.0/8"), "plain"))
+	assert.True(t, tbl.Remove(netip.MustParsePrefix("::ffff:10.0.0.0/104")))
+	assert.False(t, tbl.Remove(netip.MustParsePrefix("10.0.0.0/8")))
+	tbl.Publish()
+	assert.Empty(t, lookup(tbl, "10.1.2.3"))
+	assert.Equal(t, 1, tbl.Len())
+}
+
+func TestIPv6(t *testing.T) {
+	tbl := New[string]()
+	tbl.Add(netip.MustParsePrefix("2001:db8::/32"), "doc")
+	tbl.Add(netip.MustParsePrefix("2001:db8:1::/48"), "site")
+	tbl.Add(netip.MustParsePrefix("::/0"), "default6")
+	tbl.Publish()
+
+	assert.Equal(t, "site", lookup(tbl, "2001:db8:1::42"))
+	assert.Equal(t, "doc", lookup(tbl, "2001:db8:2::42"))
+	assert.Equal(t, "default6", lookup(tbl, "fe80::1"))
+	assert.Equal(t, "site", lookup(tbl, "2001:db8:1::42%eth0"))
+	assert.Empty(t, lookup(tbl, "10.0.0.1"))
+}
+
+// naiveLookup finds the longest matching prefix by checking all of them.
+func naiveLookup(routes map[netip.Prefix]int, addr netip.Addr) (int, bool) {
+	best := -1
+	var res int
+	for p, v := range routes {
+		if p.Contains(addr) && p.Bits() > best {
+			best, res = p.Bits(), v
+		}
+	}
+	return res, best >= 0
+}
+
+func TestRandomAgainstNaive(t *testing.T) {
+	tbl := New[int]()
+	ref := make(map[netip.Prefix]int)
+	randAddr := func() netip.Addr {
+		// Keep addresses in a small range so that prefixes overlap a lot.
+		return netip.AddrFrom4([4]byte{10, byte(rand.Intn(4)), byte(rand.Intn(256)), byte(rand.Intn(256))})
+	}
+	for i := 0; i < 3000; i++ {
+		p := netip.PrefixFrom(randAddr(), 8+rand.Intn(25)).Masked()
+		if rand.Intn(3) == 0 {
+			_, ok := ref[p]
+			delete(ref, p)
+			assert.Equal(t, ok, tbl.Remove(p))
+		} else {
+			ref[p] = i
+			tbl.Add(p, i)
+		}
+		if i%100 == 0 {
+			tbl.Publish()
+		}
+	}
+	// Check both sides.
+	for i := 0; i < 2; i++ {
+		tbl.Publish()
+		assert.Equal(t, len(ref), tbl.Len())
+		for j := 0; j < 1000; j++ {
+			addr := randAddr()
+			want, wantOk := naiveLookup(ref, addr)
+			got, ok := tbl.Lookup(addr)
+			assert.Equal(t, wantOk, ok, addr)
+			assert.Equal(t, want, got, addr)
+		}
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	tbl := New[string]()
+	tbl.Add(netip.MustParsePrefix("0.0.0.0/0"), "default")
+	tbl.Publish()
+	addr := netip.MustParseAddr("192.168.1.1")
+	p := netip.MustParsePrefix("192.168.0.0/16")
+	lrtest.ConcurrentReaders(500, func(int) {
+		// The default route is never removed.
+		_, ok := tbl.Lookup(addr)
+		assert.True(t, ok)
+	}, func(int) {
+		tbl.Add(p, "local")
+		tbl.Publish()
+		tbl.Remove(p)
+		tbl.Publish()
+	})
+}
@@ -0,0 +1,190 @@
+package lrset
+
+import (
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// Elements is a plain, unsynchronized set. It is used for caller-supplied sets and for results of set algebra.
+type Elements[E comparable] map[E]struct{}
+
+// NewElements creates an Elements set holding all the given elements.
+func NewElements[E comparable](xs ...E) Elements[E] {
+	s := make(Elements[E], len(xs))
+	for _, x := range xs {
+		s[x] = struct{}{}
+	}
+	return s
+}
+
+// Set is a set of elements of type E, protected by a LeftRightLock. Add, Remove, Clear and Publish are writes, all the
+// other methods are reads.
+type Set[E comparable] struct {
+	lr *lock.LeftRightLock
+}
+
+// New creates an empty Set.
+func New[E comparable]() *Set[E] {
+	return &Set[E]{lr: lock.NewLeftRightLock(newElementSet[E](), newElementSet[E]())}
+}
+
+// Add inserts x into the set. Returns true if x was not in the set before.
+func (s *Set[E]) Add(x E) bool {
+	return s.lr.Write(addOp[E]{x}).(bool)
+}
+
+// Remove deletes x from the set. Returns true if x was in the set before.
+func (s *Set[E]) Remove(x E) bool {
+	return s.lr.Write(removeOp[E]{x}).(bool)
+}
+
+// Clear removes all elements from the set.
+func (s *Set[E]) Clear() {
+	s.lr.Write(clearOp{})
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (s *Set[E]) Publish() {
+	s.lr.Publish()
+}
+
+// Read calls fn with a consistent view of the set. All reads done through the view observe the same published state.
+// The view must not be used after fn returns.
+func (s *Set[E]) Read(fn func(View[E])) {
+	data, art := s.lr.RLock()
+	defer s.lr.RUnlock(art)
+	fn(View[E]{*data.(*elementSet[E])})
+}
+
+// Has returns true if x is in the set.
+func (s *Set[E]) Has(x E) (ok bool) {
+	s.Read(func(v View[E]) { ok = v.Has(x) })
+	return
+}
+
+// Len returns the number of elements in the set.
+func (s *Set[E]) Len() (n int) {
+	s.Read(func(v View[E]) { n = v.Len() })
+	return
+}
+
+// Iter calls fn for every element in the set, in no particular order, until fn returns false.
+func (s *Set[E]) Iter(fn func(E) bool) {
+	s.Read(func(v View[E]) { v.Iter(fn) })
+}
+
+// Union returns a new set with all elements that are either in this set or in other.
+func (s *Set[E]) Union(other Elements[E]) (res Elements[E]) {
+	s.Read(func(v View[E]) { res = v.Union(other) })
+	return
+}
+
+// Intersect returns a new set with all elements that are both in this set and in other.
+func (s *Set[E]) Intersect(other Elements[E]) (res Elements[E]) {
+	s.Read(func(v View[E]) { res = v.Intersect(other) })
+	return
+}
+
+// Difference returns a new set with all elements that are in this set, but not in other.
+func (s *Set[E]) Difference(other Elements[E]) (res Elements[E]) {
+	s.Read(func(v View[E]) { res = v.Difference(other) })
+	return
+}
+
+// View is a read-only view of a single published side of the Set. It is only valid inside Set.Read.
+type View[E comparable] struct {
+	m elementSet[E]
+}
+
+// Has returns true if x is in the set.
+func (v View[E]) Has(x E) bool {
+	_, ok := v.m[x]
+	return ok
+}
+
+// Len returns the number of elements in the set.
+func (v View[E]) Len() int {
+	return len(v.m)
+}
+
+// Iter calls fn for every element in the set, in no particular order, until fn returns false.
+func (v View[E]) Iter(fn func(E) bool) {
+	for x := range v.m {
+		if !fn(x) {
+			return
+		}
+	}
+}
+
+// Union returns a new set with all elements that are either in this set or in other.
+func (v View[E]) Union(other Elements[E]) Elements[E] {
+	res := make(Elements[E], len(v.m)+len(other))
+	for x := range v.m {
+		res[x] = struct{}{}
+	}
+	for x := range other {
+		res[x] = struct{}{}
+	}
+	return res
+}
+
+// Intersect returns a new set with all elements that are both in this set and in other.
+func (v View[E]) Intersect(other Elements[E]) Elements[E] {
+	// Iterate over the smaller of the two sets and look up in the larger one.
+	small, large := Elements[E](v.m), other
+	if len(other) < len(v.m) {
+		small, large = other, Elements[E](v.m)
+	}
+	res := make(Elements[E])
+	for x := range small {
+		if _, ok := large[x]; ok {
+			res[x] = struct{}{}
+		}
+	}
+	return res
+}
+
+// Difference returns a new set with all elements that are in this set, but not in other.
+func (v View[E]) Difference(other Elements[E]) Elements[E] {
+	res := make(Elements[E])
+	for x := range v.m {
+		if _, ok := other[x]; !ok {
+			res[x] = struct{}{}
+		}
+	}
+	return res
+}
+
+type elementSet[E comparable] map[E]struct{}
+
+func newElementSet[E comparable]() *elementSet[E] {
+	s := make(elementSet[E])
+	return &s
+}
+
+type addOp[E comparable] struct {
+	x E
+}
+
+type removeOp[E comparable] struct {
+	x E
+}
+
+type clearOp struct{}
+
+// Update applies a single set operation.
+func (s *elementSet[E]) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case addOp[E]:
+		_, ok := (*s)[o.x]
+		(*s)[o.x] = struct{}{}
+		return !ok
+	case removeOp[E]:
+		_, ok := (*s)[o.x]
+		delete(*s, o.x)
+		return ok
+	case clearOp:
+		*s = make(elementSet[E])
+		return nil
+	}
+	panic("lrset: unknown operation")
+}
@@ -0,0 +1,107 @@
+package lrset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func TestBasic(t *testing.T) {
+	s := New[int]()
+	assert.True(t, s.Add(1))
+	assert.False(t, s.Add(1))
+	assert.True(t, s.Add(2))
+
+	// Nothing is visible before publishing.
+	assert.False(t, s.Has(1))
+	assert.Equal(t, 0, s.Len())
+
+	s.Publish()
+	assert.True(t, s.Has(1))
+	assert.True(t, s.Has(2))
+	assert.False(t, s.Has(3))
+	assert.Equal(t, 2, s.Len())
+
+	assert.True(t, s.Remove(1))
+	assert.False(t, s.Remove(1))
+	s.Publish()
+	assert.False(t, s.Has(1))
+	assert.Equal(t, 1, s.Len())
+
+	s.Clear()
+	s.Publish()
+	assert.Equal(t, 0, s.Len())
+
+	// Both sides have to stay in sync after the clear.
+	s.Add(5)
+	s.Publish()
+	s.Publish()
+	assert.Equal(t, 1, s.Len())
+	assert.True(t, s.Has(5))
+}
+
+func TestIter(t *testing.T) {
+	s := New[int]()
+	for i := 0; i < 10; i++ {
+		s.Add(i)
+	}
+	s.Publish()
+
+	seen := NewElements[int]()
+	s.Iter(func(x int) bool {
+		seen[x] = struct{}{}
+		return true
+	})
+	assert.Len(t, seen, 10)
+
+	n := 0
+	s.Iter(func(x int) bool {
+		n++
+		return n < 3
+	})
+	assert.Equal(t, 3, n)
+}
+
+func TestAlgebra(t *testing.T) {
+	s := New[int]()
+	for _, x := range []int{1, 2, 3, 4} {
+		s.Add(x)
+	}
+	s.Publish()
+	other := NewElements(3, 4, 5)
+
+	assert.Equal(t, NewElements(1, 2, 3, 4, 5), s.Union(other))
+	assert.Equal(t, NewElements(3, 4), s.Intersect(other))
+	assert.Equal(t, NewElements(1, 2), s.Difference(other))
+	assert.Equal(t, NewElements[int](), s.Intersect(NewElements[int]()))
+	assert.Equal(t, NewElements(1, 2, 3, 4), s.Difference(nil))
+
+	// The caller-supplied set is not modified.
+	assert.Equal(t, NewElements(3, 4, 5), other)
+}
+
+func TestRead(t *testing.T) {
+	s := New[string]()
+	s.Add("a")
+	s.Publish()
+	s.Read(func(v View[string]) {
+		assert.True(t, v.Has("a"))
+		assert.Equal(t, 1, v.Len())
+		assert.Equal(t, NewElements("a"), v.Union(nil))
+	})
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	s := New[int]()
+	lrtest.ConcurrentReaders(500, func(int) {
+		// Elements are always added in pairs, so every published state holds an even number of them.
+		assert.Equal(t, 0, s.Len()%2)
+	}, func(i int) {
+		s.Add(2 * i)
+		s.Add(2*i + 1)
+		s.Publish()
+	})
+	assert.Equal(t, 1000, s.Len())
+}
@@ -0,0 +1,256 @@
+package lrstats
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// DefaultBuckets are the histogram bucket upper bounds used for histograms that weren't explicitly defined.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ErrAlreadyDefined is returned when defining a histogram that already exists.
+var ErrAlreadyDefined = errors.New("lrstats: histogram already defined")
+
+// Registry is a set of named counters, gauges and histograms protected by a LeftRightLock. Add, Set, Observe,
+// DefineHistogram and Publish are writes, while Read and Snapshot are reads.
+//
+// The writer merges all updates since the last Publish into a single batch, which is applied to both sides at once.
+// Readers therefore always see all metrics as of the same Publish, which independent atomics can't offer.
+type Registry struct {
+	lr *lock.LeftRightLock
+	// bounds holds the bucket upper bounds of every histogram known to the writer.
+	bounds map[string][]float64
+	// pending holds the updates merged since the last Publish.
+	pending *batch
+}
+
+// New creates an empty Registry.
+func New() *Registry {
+	return &Registry{
+		lr:      lock.NewLeftRightLock(newMetrics(), newMetrics()),
+		bounds:  make(map[string][]float64),
+		pending: newBatch(),
+	}
+}
+
+// Add increments the named counter by delta.
+func (r *Registry) Add(name string, delta int64) {
+	r.pending.counters[name] += delta
+}
+
+// Set sets the named gauge to value.
+func (r *Registry) Set(name string, value float64) {
+	r.pending.gauges[name] = value
+}
+
+// DefineHistogram creates the named histogram with the given bucket upper bounds. Histograms that are observed without
+// being defined use DefaultBuckets.
+func (r *Registry) DefineHistogram(name string, bounds []float64) error {
+	if _, ok := r.bounds[name]; ok {
+		return ErrAlreadyDefined
+	}
+	b := make([]float64, len(bounds))
+	copy(b, bounds)
+	sort.Float64s(b)
+	r.bounds[name] = b
+	return nil
+}
+
+// Observe records value in the named histogram.
+func (r *Registry) Observe(name string, value float64) {
+	bounds, ok := r.bounds[name]
+	if !ok {
+		bounds = DefaultBuckets
+		r.bounds[name] = bounds
+	}
+	h, ok := r.pending.histograms[name]
+	if !ok {
+		h = newHistogram(bounds)
+		r.pending.histograms[name] = h
+	}
+	h.observe(value)
+}
+
+// Publish makes all the updates since the last Publish visible to readers at once.
+func (r *Registry) Publish() {
+	r.lr.Write(r.pending)
+	r.pending = newBatch()
+	r.lr.Publish()
+}
+
+// Read calls fn with a consistent view of all metrics. All reads done through the view observe the same Publish. The
+// view must not be used after fn returns.
+func (r *Registry) Read(fn func(View)) {
+	data, art := r.lr.RLock()
+	defer r.lr.RUnlock(art)
+	fn(View{data.(*metrics)})
+}
+
+// Snapshot returns a copy of all metrics as of the last Publish.
+func (r *Registry) Snapshot() (s Snapshot) {
+	r.Read(func(v View) { s = v.Snapshot() })
+	return
+}
+
+// HistogramSnapshot is a copy of a histogram. Counts[i] is the number of observations that were at most Bounds[i] (and
+// more than Bounds[i-1]), and the last element of Counts holds observations larger than all bounds.
+type HistogramSnapshot struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+// Snapshot is a copy of all metrics in a Registry as of a single Publish.
+type Snapshot struct {
+	// Generation is the number of publishes the snapshot reflects.
+	Generation uint64
+	Counters   map[string]int64
+	Gauges     map[string]float64
+	Histograms map[string]HistogramSnapshot
+}
+
+// View is a read-only view of a single published side of the Registry. It is only valid inside Registry.Read.
+type View struct {
+	m *metrics
+}
+
+// Generation returns the number of publishes the view reflects.
+func (v View) Generation() uint64 {
+	return v.m.generation
+}
+
+// Counter returns the value of the named counter.
+func (v View) Counter(name string) (int64, bool) {
+	c, ok := v.m.counters[name]
+	return c, ok
+}
+
+// Gauge returns the value of the named gauge.
+func (v View) Gauge(name string) (float64, bool) {
+	g, ok := v.m.gauges[name]
+	return g, ok
+}
+
+// Histogram returns a copy of the named histogram.
+func (v View) Histogram(name string) (HistogramSnapshot, bool) {
+	h, ok := v.m.histograms[name]
+	if !ok {
+		return HistogramSnapshot{}, false
+	}
+	return h.snapshot(), true
+}
+
+// Snapshot returns a copy of all metrics.
+func (v View) Snapshot() Snapshot {
+	s := Snapshot{
+		Generation: v.m.generation,
+		Counters:   make(map[string]int64, len(v.m.counters)),
+		Gauges:     make(map[string]float64, len(v.m.gauges)),
+		Histograms: make(map[string]HistogramSnapshot, len(v.m.histograms)),
+	}
+	for name, c := range v.m.counters {
+		s.Counters[name] = c
+	}
+	for name, g := range v.m.gauges {
+		s.Gauges[name] = g
+	}
+	for name, h := range v.m.histograms {
+		s.Histograms[name] = h.snapshot()
+	}
+	return s
+}
+
+// histogram is used both for the published histograms and for the pending observations.
+type histogram struct {
+	// bounds is shared between the writer, both sides and all batches, and is never modified.
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(value float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, value)]++
+	h.sum += value
+	h.count++
+}
+
+func (h *histogram) merge(o *histogram) {
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.sum += o.sum
+	h.count += o.count
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		Bounds: make([]float64, len(h.bounds)),
+		Counts: make([]uint64, len(h.counts)),
+		Sum:    h.sum,
+		Count:  h.count,
+	}
+	copy(s.Bounds, h.bounds)
+	copy(s.Counts, h.counts)
+	return s
+}
+
+// batch holds all updates merged by the writer between two publishes. It is the only operation applied to metrics, and
+// it is not modified once written.
+type batch struct {
+	counters   map[string]int64
+	gauges     map[string]float64
+	histograms map[string]*histogram
+}
+
+func newBatch() *batch {
+	return &batch{
+		counters:   make(map[string]int64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]*histogram),
+	}
+}
+
+// metrics is one copy of all the metric values.
+type metrics struct {
+	generation uint64
+	counters   map[string]int64
+	gauges     map[string]float64
+	histograms map[string]*histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		counters:   make(map[string]int64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]*histogram),
+	}
+}
+
+// Update applies a batch of updates.
+func (m *metrics) Update(op lock.Operation) lock.OpResult {
+	b := op.(*batch)
+	for name, delta := range b.counters {
+		m.counters[name] += delta
+	}
+	for name, value := range b.gauges {
+		m.gauges[name] = value
+	}
+	for name, delta := range b.histograms {
+		h, ok := m.histograms[name]
+		if !ok {
+			h = newHistogram(delta.bounds)
+			m.histograms[name] = h
+		}
+		h.merge(delta)
+	}
+	m.generation++
+	return m.generation
+}
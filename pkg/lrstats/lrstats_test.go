@@ -0,0 +1,107 @@
+package lrstats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func TestCountersAndGauges(t *testing.T) {
+	r := New()
+	r.Add("requests", 1)
+	r.Add("requests", 2)
+	r.Set("inflight", 5)
+	r.Set("inflight", 3)
+
+	r.Read(func(v View) {
+		_, ok := v.Counter("requests")
+		assert.False(t, ok)
+		assert.Equal(t, uint64(0), v.Generation())
+	})
+
+	r.Publish()
+	r.Read(func(v View) {
+		c, ok := v.Counter("requests")
+		assert.True(t, ok)
+		assert.Equal(t, int64(3), c)
+		g, ok := v.Gauge("inflight")
+		assert.True(t, ok)
+		assert.Equal(t, 3.0, g)
+		assert.Equal(t, uint64(1), v.Generation())
+	})
+
+	// Counters accumulate over publishes on both sides.
+	r.Add("requests", 10)
+	r.Publish()
+	r.Add("requests", 100)
+	r.Publish()
+	s := r.Snapshot()
+	assert.Equal(t, uint64(3), s.Generation)
+	assert.Equal(t, map[string]int64{"requests": 113}, s.Counters)
+	assert.Equal(t, map[string]float64{"inflight": 3}, s.Gauges)
+}
+
+func TestHistogram(t *testing.T) {
+	r := New()
+	assert.Nil(t, r.DefineHistogram("latency", []float64{10, 1, 100}))
+	assert.Equal(t, ErrAlreadyDefined, r.DefineHistogram("latency", []float64{1}))
+
+	for _, v := range []float64{0.5, 1, 5, 50, 500} {
+		r.Observe("latency", v)
+	}
+	r.Observe("other", 0.001)
+	r.Publish()
+	r.Observe("latency", 2)
+	r.Publish()
+
+	h := r.Snapshot().Histograms["latency"]
+	assert.Equal(t, []float64{1, 10, 100}, h.Bounds)
+	assert.Equal(t, []uint64{2, 2, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(6), h.Count)
+	assert.Equal(t, 558.5, h.Sum)
+
+	r.Read(func(v View) {
+		h, ok := v.Histogram("other")
+		assert.True(t, ok)
+		assert.Equal(t, DefaultBuckets, h.Bounds)
+		assert.Equal(t, uint64(1), h.Counts[0])
+		_, ok = v.Histogram("missing")
+		assert.False(t, ok)
+	})
+}
+
+func TestSnapshotIsACopy(t *testing.T) {
+	r := New()
+	r.Observe("h", 1)
+	r.Add("c", 1)
+	r.Publish()
+	s := r.Snapshot()
+	s.Counters["c"] = 100
+	s.Histograms["h"].Counts[0] = 100
+
+	s = r.Snapshot()
+	assert.Equal(t, int64(1), s.Counters["c"])
+	assert.Equal(t, uint64(0), s.Histograms["h"].Counts[0])
+}
+
+func TestConsistentReads(t *testing.T) {
+	r := New()
+	lrtest.ConcurrentReaders(1000, func(int) {
+		// The writer always updates these together, so readers must never see them differ.
+		r.Read(func(v View) {
+			hits, _ := v.Counter("hits")
+			total, _ := v.Counter("total")
+			h, _ := v.Histogram("size")
+			assert.Equal(t, hits, total)
+			assert.Equal(t, uint64(hits), h.Count)
+			assert.Equal(t, uint64(hits), v.Generation())
+		})
+	}, func(i int) {
+		r.Add("hits", 1)
+		r.Add("total", 1)
+		r.Observe("size", float64(i))
+		r.Publish()
+	})
+}
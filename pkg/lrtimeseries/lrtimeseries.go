@@ -0,0 +1,267 @@
+package lrtimeseries
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// Resolution selects the granularity of a Range query.
+type Resolution int
+
+const (
+	// Raw returns every appended point as a bucket of its own.
+	Raw Resolution = iota
+	// Second returns one-second rollups.
+	Second
+	// Minute returns one-minute rollups.
+	Minute
+	// Hour returns one-hour rollups.
+	Hour
+	numResolutions
+)
+
+// widths holds the bucket width of every resolution in nanoseconds. Raw points have no width.
+var widths = [numResolutions]int64{0, int64(time.Second), int64(time.Minute), int64(time.Hour)}
+
+// Bucket is an aggregate of all points appended to a series within [Start, Start+resolution). For Raw resolution
+// every bucket holds a single point and Start is its timestamp.
+type Bucket struct {
+	Start time.Time
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count int
+	// Last is the value of the point with the latest timestamp. Points with equal timestamps are ordered by the time
+	// they were appended.
+	Last float64
+}
+
+// Avg returns the average value of the points in the bucket.
+func (b Bucket) Avg() float64 {
+	return b.Sum / float64(b.Count)
+}
+
+// Options configure a Store.
+type Options struct {
+	// Retention is how long data is kept at every resolution, relative to the time passed to Expire. Zero means
+	// forever. Typically raw data is kept for a short time and coarser rollups for progressively longer.
+	Retention [numResolutions]time.Duration
+	// Now returns the current time and is used by Publish to expire old data. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Store is a set of named time series protected by a LeftRightLock. Append, Expire and Publish are writes, while Range
+// and Series are reads.
+//
+// The writer maintains one-second, one-minute and one-hour rollups of every series as points are appended, so readers
+// can query long ranges without aggregating raw data.
+type Store struct {
+	lr   *lock.LeftRightLock
+	opts Options
+}
+
+// New creates an empty Store.
+func New(opts Options) *Store {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Store{
+		lr:   lock.NewLeftRightLock(newSeriesMap(), newSeriesMap()),
+		opts: opts,
+	}
+}
+
+// Append adds a point to the series and updates its rollups. Points don't have to be appended in order, but appending
+// in order is the fastest.
+func (s *Store) Append(series string, ts time.Time, value float64) {
+	s.lr.Write(appendOp{series, ts.UnixNano(), value})
+}
+
+// Expire removes data older than the retention of each resolution, relative to now.
+func (s *Store) Expire(now time.Time) {
+	var op expireOp
+	enabled := false
+	for r, retention := range s.opts.Retention {
+		if retention > 0 {
+			op.cutoffs[r] = now.Add(-retention).UnixNano()
+			op.enabled[r] = true
+			enabled = true
+		}
+	}
+	if enabled {
+		s.lr.Write(op)
+	}
+}
+
+// Publish expires old data and makes all the writes since the last Publish visible to readers.
+func (s *Store) Publish() {
+	s.Expire(s.opts.Now())
+	s.lr.Publish()
+}
+
+// Series returns the sorted names of all series.
+func (s *Store) Series() []string {
+	data, art := s.lr.RLock()
+	defer s.lr.RUnlock(art)
+	m := data.(*seriesMap)
+	res := make([]string, 0, len(*m))
+	for name := range *m {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Range returns the buckets of the series at the given resolution that start within [from, to), in time order.
+func (s *Store) Range(series string, from, to time.Time, res Resolution) []Bucket {
+	if res < Raw || res >= numResolutions {
+		return nil
+	}
+	data, art := s.lr.RLock()
+	defer s.lr.RUnlock(art)
+	sr, ok := (*data.(*seriesMap))[series]
+	if !ok {
+		return nil
+	}
+	buckets := sr[res]
+	lo := sort.Search(len(buckets), func(i int) bool { return buckets[i].start >= from.UnixNano() })
+	hi := sort.Search(len(buckets), func(i int) bool { return buckets[i].start >= to.UnixNano() })
+	if lo >= hi {
+		return nil
+	}
+	out := make([]Bucket, hi-lo)
+	for i, b := range buckets[lo:hi] {
+		out[i] = Bucket{time.Unix(0, b.start), b.min, b.max, b.sum, b.count, b.last}
+	}
+	return out
+}
+
+// bucket is the internal representation of Bucket, using unix nanoseconds for timestamps.
+type bucket struct {
+	start    int64
+	min, max float64
+	sum      float64
+	count    int
+	last     float64
+	// lastTs is the timestamp of the point last was taken from.
+	lastTs int64
+}
+
+func (b *bucket) add(ts int64, value float64) {
+	if value < b.min {
+		b.min = value
+	}
+	if value > b.max {
+		b.max = value
+	}
+	b.sum += value
+	b.count++
+	if ts >= b.lastTs {
+		b.last, b.lastTs = value, ts
+	}
+}
+
+// series holds buckets sorted by start time for every resolution.
+type series [numResolutions][]bucket
+
+// floorTo truncates ts down to a multiple of width, rounding towards negative infinity.
+func floorTo(ts, width int64) int64 {
+	r := ts % width
+	if r < 0 {
+		r += width
+	}
+	return ts - r
+}
+
+func (s *series) add(ts int64, value float64) {
+	for r := Raw; r < numResolutions; r++ {
+		start := ts
+		if r != Raw {
+			start = floorTo(ts, widths[r])
+		}
+		buckets := s[r]
+		// Points mostly arrive in order, so check the last bucket before searching.
+		i := len(buckets)
+		if i > 0 && buckets[i-1].start > start {
+			i = sort.Search(len(buckets), func(i int) bool { return buckets[i].start > start })
+		}
+		if r != Raw && i > 0 && buckets[i-1].start == start {
+			buckets[i-1].add(ts, value)
+			continue
+		}
+		// Raw points always get a bucket of their own, after any points with the same timestamp.
+		buckets = append(buckets, bucket{})
+		copy(buckets[i+1:], buckets[i:])
+		buckets[i] = bucket{start: start, min: value, max: value, sum: value, count: 1, last: value, lastTs: ts}
+		s[r] = buckets
+	}
+}
+
+// expire drops buckets that end before the cutoff of their resolution. Returns true if the series is left empty.
+func (s *series) expire(op expireOp) bool {
+	empty := true
+	for r := Raw; r < numResolutions; r++ {
+		buckets := s[r]
+		if op.enabled[r] {
+			// A bucket is only dropped once all of its points are older than the cutoff. Raw points are treated as
+			// buckets one nanosecond wide.
+			width := widths[r]
+			if width == 0 {
+				width = 1
+			}
+			cutoff := op.cutoffs[r] - width
+			i := sort.Search(len(buckets), func(i int) bool { return buckets[i].start > cutoff })
+			// Move the remaining buckets to the front, so the slice keeps reusing its capacity instead of creeping
+			// forward through ever new allocations.
+			n := copy(buckets, buckets[i:])
+			buckets = buckets[:n]
+			s[r] = buckets
+		}
+		empty = empty && len(buckets) == 0
+	}
+	return empty
+}
+
+// seriesMap is one copy of all the series, by name.
+type seriesMap map[string]*series
+
+func newSeriesMap() *seriesMap {
+	m := make(seriesMap)
+	return &m
+}
+
+type appendOp struct {
+	series string
+	ts     int64
+	value  float64
+}
+
+// expireOp carries the cutoffs computed by the writer, so both sides expire exactly the same data.
+type expireOp struct {
+	cutoffs [numResolutions]int64
+	enabled [numResolutions]bool
+}
+
+// Update applies a single operation.
+func (m *seriesMap) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case appendOp:
+		s, ok := (*m)[o.series]
+		if !ok {
+			s = &series{}
+			(*m)[o.series] = s
+		}
+		s.add(o.ts, o.value)
+		return nil
+	case expireOp:
+		for name, s := range *m {
+			if s.expire(o) {
+				delete(*m, name)
+			}
+		}
+		return nil
+	}
+	panic("lrtimeseries: unknown operation")
+}
@@ -0,0 +1,144 @@
+package lrtimeseries
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+var t0 = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestRollups(t *testing.T) {
+	s := New(Options{})
+	s.Append("cpu", t0, 1)
+	s.Append("cpu", t0.Add(500*time.Millisecond), 3)
+	s.Append("cpu", t0.Add(1500*time.Millisecond), 5)
+	s.Append("cpu", t0.Add(61*time.Second), 7)
+	assert.Nil(t, s.Range("cpu", t0, t0.Add(time.Hour), Raw))
+
+	s.Publish()
+	assert.Equal(t, []string{"cpu"}, s.Series())
+
+	raw := s.Range("cpu", t0, t0.Add(time.Hour), Raw)
+	assert.Len(t, raw, 4)
+	assert.Equal(t, t0.Add(500*time.Millisecond).UnixNano(), raw[1].Start.UnixNano())
+	assert.Equal(t, 3.0, raw[1].Last)
+
+	secs := s.Range("cpu", t0, t0.Add(time.Hour), Second)
+	assert.Len(t, secs, 3)
+	assert.Equal(t, Bucket{time.Unix(0, t0.UnixNano()), 1, 3, 4, 2, 3}, secs[0])
+	assert.Equal(t, 2.0, secs[0].Avg())
+	assert.Equal(t, t0.Add(time.Second).UnixNano(), secs[1].Start.UnixNano())
+
+	mins := s.Range("cpu", t0, t0.Add(time.Hour), Minute)
+	assert.Len(t, mins, 2)
+	assert.Equal(t, 3, mins[0].Count)
+	assert.Equal(t, 5.0, mins[0].Last)
+	assert.Equal(t, 7.0, mins[1].Last)
+
+	hours := s.Range("cpu", t0, t0.Add(time.Hour), Hour)
+	assert.Len(t, hours, 1)
+	assert.Equal(t, Bucket{time.Unix(0, t0.UnixNano()), 1, 7, 16, 4, 7}, hours[0])
+
+	// The range is half-open and selects buckets by their start.
+	assert.Len(t, s.Range("cpu", t0.Add(time.Second), t0.Add(61*time.Second), Second), 1)
+	assert.Nil(t, s.Range("cpu", t0, t0, Second))
+	assert.Nil(t, s.Range("missing", t0, t0.Add(time.Hour), Second))
+	assert.Nil(t, s.Range("cpu", t0, t0.Add(time.Hour), Resolution(42)))
+}
+
+func TestOutOfOrder(t *testing.T) {
+	s := New(Options{})
+	s.Append("m", t0.Add(2*time.Second), 2)
+	s.Append("m", t0, 0)
+	s.Append("m", t0.Add(time.Second), 1)
+	// A late point with an earlier timestamp doesn't become the last value of its bucket.
+	s.Append("m", t0.Add(1900*time.Millisecond), 9)
+	s.Append("m", t0.Add(1100*time.Millisecond), 5)
+	s.Publish()
+
+	var starts []int64
+	for _, b := range s.Range("m", t0, t0.Add(time.Minute), Raw) {
+		starts = append(starts, b.Start.Sub(t0).Milliseconds())
+	}
+	assert.Equal(t, []int64{0, 1000, 1100, 1900, 2000}, starts)
+
+	secs := s.Range("m", t0, t0.Add(time.Minute), Second)
+	assert.Len(t, secs, 3)
+	assert.Equal(t, 3, secs[1].Count)
+	assert.Equal(t, 9.0, secs[1].Last)
+	assert.Equal(t, 9.0, secs[1].Max)
+}
+
+func TestExpire(t *testing.T) {
+	now := t0
+	var retention [numResolutions]time.Duration
+	retention[Raw] = 10 * time.Second
+	retention[Second] = time.Minute
+	s := New(Options{Retention: retention, Now: func() time.Time { return now }})
+	for i := 0; i < 120; i++ {
+		s.Append("m", t0.Add(time.Duration(i)*time.Second), float64(i))
+	}
+	s.Append("old", t0.Add(-time.Hour), 1)
+	now = t0.Add(120 * time.Second)
+	s.Publish()
+
+	raw := s.Range("m", t0, now, Raw)
+	assert.Len(t, raw, 10)
+	assert.Equal(t, 110.0, raw[0].Last)
+	assert.Len(t, s.Range("m", t0, now, Second), 60)
+	assert.Len(t, s.Range("m", t0, now, Minute), 2)
+
+	// A series that had all its data expired is dropped, unless coarser resolutions keep it.
+	assert.Equal(t, []string{"m", "old"}, s.Series())
+	retention[Minute] = time.Minute
+	retention[Hour] = time.Minute
+	s.opts.Retention = retention
+	s.Publish()
+	assert.Equal(t, []string{"m"}, s.Series())
+
+	// Check the other side as well.
+	s.Publish()
+	assert.Len(t, s.Range("m", t0, now, Raw), 10)
+	assert.Equal(t, []string{"m"}, s.Series())
+}
+
+func TestSidesConsistent(t *testing.T) {
+	s := New(Options{})
+	for i := 0; i < 2000; i++ {
+		s.Append("m", t0.Add(time.Duration(rand.Intn(600))*time.Second/7), float64(rand.Intn(100)))
+		if i%100 == 0 {
+			s.Publish()
+		}
+	}
+	s.Publish()
+	var first [numResolutions][]Bucket
+	for r := Raw; r < numResolutions; r++ {
+		first[r] = s.Range("m", t0, t0.Add(time.Hour), r)
+	}
+	s.Publish()
+	for r := Raw; r < numResolutions; r++ {
+		assert.Equal(t, first[r], s.Range("m", t0, t0.Add(time.Hour), r))
+	}
+	assert.Len(t, first[Raw], 2000)
+	assert.Equal(t, 2000, first[Hour][0].Count)
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	s := New(Options{})
+	lrtest.ConcurrentReaders(500, func(int) {
+		// Points are always appended in pairs within the same second.
+		for _, b := range s.Range("m", t0, t0.Add(time.Hour), Second) {
+			assert.Equal(t, 2, b.Count)
+		}
+	}, func(i int) {
+		ts := t0.Add(time.Duration(i) * time.Second)
+		s.Append("m", ts, 1)
+		s.Append("m", ts.Add(time.Millisecond), 2)
+		s.Publish()
+	})
+}
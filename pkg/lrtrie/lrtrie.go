@@ -0,0 +1,357 @@
+package lrtrie
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bitstonks/leftright/pkg/lock"
+)
+
+// Trie is a prefix tree (a path compressed radix tree over bytes) with values of type V, protected by a LeftRightLock.
+// Insert, Delete, DeletePrefix and Publish are writes, all the other methods are reads.
+type Trie[V any] struct {
+	lr *lock.LeftRightLock
+}
+
+// New creates an empty Trie.
+func New[V any]() *Trie[V] {
+	return &Trie[V]{lr: lock.NewLeftRightLock(newTree[V](), newTree[V]())}
+}
+
+// Insert sets the value for key. Returns true if the key was not in the trie before.
+func (t *Trie[V]) Insert(key string, value V) bool {
+	return t.lr.Write(insertOp[V]{key, value}).(bool)
+}
+
+// InsertBytes is like Insert, but takes the key as a byte slice.
+func (t *Trie[V]) InsertBytes(key []byte, value V) bool {
+	return t.Insert(string(key), value)
+}
+
+// Delete removes key from the trie. Returns true if it was in the trie before.
+func (t *Trie[V]) Delete(key string) bool {
+	return t.lr.Write(deleteOp{key}).(bool)
+}
+
+// DeleteBytes is like Delete, but takes the key as a byte slice.
+func (t *Trie[V]) DeleteBytes(key []byte) bool {
+	return t.Delete(string(key))
+}
+
+// DeletePrefix removes all keys starting with prefix and returns how many were removed.
+func (t *Trie[V]) DeletePrefix(prefix string) int {
+	return t.lr.Write(deletePrefixOp{prefix}).(int)
+}
+
+// Publish makes all the writes since the last Publish visible to readers.
+func (t *Trie[V]) Publish() {
+	t.lr.Publish()
+}
+
+// Len returns the number of keys in the trie.
+func (t *Trie[V]) Len() int {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	return data.(*tree[V]).size
+}
+
+// Lookup returns the value stored for key.
+func (t *Trie[V]) Lookup(key string) (V, bool) {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	return data.(*tree[V]).lookup(key)
+}
+
+// LookupBytes is like Lookup, but takes the key as a byte slice.
+func (t *Trie[V]) LookupBytes(key []byte) (V, bool) {
+	return t.Lookup(string(key))
+}
+
+// LongestPrefixMatch finds the longest key in the trie that is a prefix of s, and returns it along with its value.
+func (t *Trie[V]) LongestPrefixMatch(s string) (string, V, bool) {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	n, v, ok := data.(*tree[V]).longestPrefixMatch(s)
+	return s[:n], v, ok
+}
+
+// LongestPrefixMatchBytes is like LongestPrefixMatch, but takes the input as a byte slice and returns the matched
+// prefix as a sub-slice of it.
+func (t *Trie[V]) LongestPrefixMatchBytes(b []byte) ([]byte, V, bool) {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	n, v, ok := data.(*tree[V]).longestPrefixMatch(string(b))
+	return b[:n], v, ok
+}
+
+// WalkPrefix calls fn for every key starting with prefix, in lexicographic order, until fn returns false.
+func (t *Trie[V]) WalkPrefix(prefix string, fn func(key string, value V) bool) {
+	data, art := t.lr.RLock()
+	defer t.lr.RUnlock(art)
+	data.(*tree[V]).walkPrefix(prefix, fn)
+}
+
+// node is a single node of the radix tree. Children are sorted by the first byte of their prefix, which is unique among
+// siblings.
+type node[V any] struct {
+	// prefix is the label on the edge from the parent to this node.
+	prefix   string
+	children []*node[V]
+	value    V
+	hasValue bool
+}
+
+// child returns the index of the child whose prefix starts with b, and whether such a child exists. If it doesn't,
+// the index is where it would have to be inserted.
+func (n *node[V]) child(b byte) (int, bool) {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].prefix[0] >= b })
+	return i, i < len(n.children) && n.children[i].prefix[0] == b
+}
+
+// compactChild removes the i-th child if it holds nothing, or merges it with its only child if it holds no value.
+func (n *node[V]) compactChild(i int) {
+	c := n.children[i]
+	if c.hasValue {
+		return
+	}
+	switch len(c.children) {
+	case 0:
+		n.children = append(n.children[:i], n.children[i+1:]...)
+	case 1:
+		gc := c.children[0]
+		gc.prefix = c.prefix + gc.prefix
+		n.children[i] = gc
+	}
+}
+
+// count returns the number of values in the subtree rooted at n.
+func (n *node[V]) count() int {
+	res := 0
+	if n.hasValue {
+		res++
+	}
+	for _, c := range n.children {
+		res += c.count()
+	}
+	return res
+}
+
+// walk calls fn for every value in the subtree rooted at n in lexicographic order. The key of n is given in key.
+// Returns false if fn asked to stop.
+func (n *node[V]) walk(key string, fn func(string, V) bool) bool {
+	if n.hasValue && !fn(key, n.value) {
+		return false
+	}
+	for _, c := range n.children {
+		if !c.walk(key+c.prefix, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathStep remembers which child we descended into, so that the tree can be compacted on the way back up.
+type pathStep[V any] struct {
+	parent *node[V]
+	idx    int
+}
+
+// tree is one copy of the trie.
+type tree[V any] struct {
+	root *node[V]
+	size int
+}
+
+func newTree[V any]() *tree[V] {
+	return &tree[V]{root: &node[V]{}}
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (t *tree[V]) insert(key string, value V) bool {
+	n := t.root
+	for key != "" {
+		i, ok := n.child(key[0])
+		if !ok {
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = &node[V]{prefix: key}
+			n = n.children[i]
+			break
+		}
+		c := n.children[i]
+		common := commonPrefixLen(c.prefix, key)
+		if common < len(c.prefix) {
+			// Split the edge, so that key ends on a node or branches off from one.
+			mid := &node[V]{prefix: c.prefix[:common], children: []*node[V]{c}}
+			c.prefix = c.prefix[common:]
+			n.children[i] = mid
+			c = mid
+		}
+		n = c
+		key = key[common:]
+	}
+	isNew := !n.hasValue
+	n.value = value
+	n.hasValue = true
+	if isNew {
+		t.size++
+	}
+	return isNew
+}
+
+func (t *tree[V]) delete(key string) bool {
+	n := t.root
+	var path []pathStep[V]
+	for key != "" {
+		i, ok := n.child(key[0])
+		if !ok || !strings.HasPrefix(key, n.children[i].prefix) {
+			return false
+		}
+		path = append(path, pathStep[V]{n, i})
+		key = key[len(n.children[i].prefix):]
+		n = n.children[i]
+	}
+	if !n.hasValue {
+		return false
+	}
+	var zero V
+	n.value = zero
+	n.hasValue = false
+	t.size--
+	t.compact(path)
+	return true
+}
+
+func (t *tree[V]) deletePrefix(prefix string) int {
+	if prefix == "" {
+		removed := t.size
+		t.root = &node[V]{}
+		t.size = 0
+		return removed
+	}
+	n := t.root
+	var path []pathStep[V]
+	for {
+		i, ok := n.child(prefix[0])
+		if !ok {
+			return 0
+		}
+		c := n.children[i]
+		if strings.HasPrefix(c.prefix, prefix) {
+			// Every key in the subtree of c starts with prefix.
+			removed := c.count()
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			t.size -= removed
+			t.compact(path)
+			return removed
+		}
+		if !strings.HasPrefix(prefix, c.prefix) {
+			return 0
+		}
+		path = append(path, pathStep[V]{n, i})
+		prefix = prefix[len(c.prefix):]
+		n = c
+	}
+}
+
+// compact walks the path back up to the root and removes or merges nodes that no longer hold anything.
+func (t *tree[V]) compact(path []pathStep[V]) {
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].parent.compactChild(path[i].idx)
+	}
+}
+
+func (t *tree[V]) lookup(key string) (V, bool) {
+	n := t.root
+	for key != "" {
+		i, ok := n.child(key[0])
+		if !ok || !strings.HasPrefix(key, n.children[i].prefix) {
+			var zero V
+			return zero, false
+		}
+		key = key[len(n.children[i].prefix):]
+		n = n.children[i]
+	}
+	return n.value, n.hasValue
+}
+
+// longestPrefixMatch returns the length of the longest key that is a prefix of s, along with its value.
+func (t *tree[V]) longestPrefixMatch(s string) (int, V, bool) {
+	n := t.root
+	matched, depth := 0, 0
+	var value V
+	found := n.hasValue
+	if found {
+		value = n.value
+	}
+	for depth < len(s) {
+		i, ok := n.child(s[depth])
+		if !ok || !strings.HasPrefix(s[depth:], n.children[i].prefix) {
+			break
+		}
+		n = n.children[i]
+		depth += len(n.prefix)
+		if n.hasValue {
+			matched, value, found = depth, n.value, true
+		}
+	}
+	return matched, value, found
+}
+
+func (t *tree[V]) walkPrefix(prefix string, fn func(string, V) bool) {
+	n := t.root
+	key := ""
+	for rest := prefix; rest != ""; {
+		i, ok := n.child(rest[0])
+		if !ok {
+			return
+		}
+		c := n.children[i]
+		if strings.HasPrefix(c.prefix, rest) {
+			// The prefix ends in the middle (or at the end) of this edge.
+			key += c.prefix
+			n = c
+			break
+		}
+		if !strings.HasPrefix(rest, c.prefix) {
+			return
+		}
+		key += c.prefix
+		rest = rest[len(c.prefix):]
+		n = c
+	}
+	n.walk(key, fn)
+}
+
+type insertOp[V any] struct {
+	key   string
+	value V
+}
+
+type deleteOp struct {
+	key string
+}
+
+type deletePrefixOp struct {
+	prefix string
+}
+
+// Update applies a single trie operation.
+func (t *tree[V]) Update(op lock.Operation) lock.OpResult {
+	switch o := op.(type) {
+	case insertOp[V]:
+		return t.insert(o.key, o.value)
+	case deleteOp:
+		return t.delete(o.key)
+	case deletePrefixOp:
+		return t.deletePrefix(o.prefix)
+	}
+	panic("lrtrie: unknown operation")
+}
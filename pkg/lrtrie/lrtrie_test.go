@@ -0,0 +1,200 @@
+package lrtrie
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bitstonks/leftright/internal/lrtest"
+)
+
+func keys[V any](t *Trie[V], prefix string) (res []string) {
+	t.WalkPrefix(prefix, func(key string, _ V) bool {
+		res = append(res, key)
+		return true
+	})
+	return
+}
+
+func TestBasic(t *testing.T) {
+	tr := New[int]()
+	assert.True(t, tr.Insert("team", 1))
+	assert.True(t, tr.Insert("tea", 2))
+	assert.True(t, tr.Insert("ten", 3))
+	assert.False(t, tr.Insert("ten", 4))
+	assert.True(t, tr.InsertBytes([]byte("to"), 5))
+
+	_, ok := tr.Lookup("tea")
+	assert.False(t, ok)
+	tr.Publish()
+	assert.Equal(t, 4, tr.Len())
+
+	for key, want := range map[string]int{"team": 1, "tea": 2, "ten": 4, "to": 5} {
+		v, ok := tr.Lookup(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, want, v, key)
+	}
+	for _, key := range []string{"", "t", "te", "teams", "x"} {
+		_, ok := tr.Lookup(key)
+		assert.False(t, ok, key)
+	}
+	v, ok := tr.LookupBytes([]byte("to"))
+	assert.True(t, ok)
+	assert.Equal(t, 5, v)
+
+	assert.True(t, tr.Delete("tea"))
+	assert.False(t, tr.Delete("tea"))
+	assert.False(t, tr.DeleteBytes([]byte("te")))
+	tr.Publish()
+	_, ok = tr.Lookup("tea")
+	assert.False(t, ok)
+	_, ok = tr.Lookup("team")
+	assert.True(t, ok)
+	assert.Equal(t, 3, tr.Len())
+}
+
+func TestLongestPrefixMatch(t *testing.T) {
+	tr := New[string]()
+	tr.Insert("/", "root")
+	tr.Insert("/api/", "api")
+	tr.Insert("/api/v1/users", "users")
+	tr.Publish()
+
+	m, v, ok := tr.LongestPrefixMatch("/api/v1/users/42")
+	assert.True(t, ok)
+	assert.Equal(t, "/api/v1/users", m)
+	assert.Equal(t, "users", v)
+
+	m, v, ok = tr.LongestPrefixMatch("/api/v2/items")
+	assert.True(t, ok)
+	assert.Equal(t, "/api/", m)
+	assert.Equal(t, "api", v)
+
+	mb, v, ok := tr.LongestPrefixMatchBytes([]byte("/static"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("/"), mb)
+	assert.Equal(t, "root", v)
+
+	_, _, ok = tr.LongestPrefixMatch("api")
+	assert.False(t, ok)
+
+	// The empty key matches everything.
+	tr.Insert("", "default")
+	tr.Publish()
+	m, v, ok = tr.LongestPrefixMatch("api")
+	assert.True(t, ok)
+	assert.Equal(t, "", m)
+	assert.Equal(t, "default", v)
+}
+
+func TestWalkPrefix(t *testing.T) {
+	tr := New[int]()
+	for _, k := range []string{"banana", "band", "bandana", "apple", "ban", "cherry"} {
+		tr.Insert(k, len(k))
+	}
+	tr.Publish()
+
+	assert.Equal(t, []string{"apple", "ban", "banana", "band", "bandana", "cherry"}, keys(tr, ""))
+	assert.Equal(t, []string{"ban", "banana", "band", "bandana"}, keys(tr, "ba"))
+	assert.Equal(t, []string{"band", "bandana"}, keys(tr, "band"))
+	assert.Equal(t, []string{"bandana"}, keys(tr, "banda"))
+	assert.Nil(t, keys(tr, "bx"))
+	assert.Nil(t, keys(tr, "bandanas"))
+
+	var got []string
+	tr.WalkPrefix("b", func(key string, _ int) bool {
+		got = append(got, key)
+		return len(got) < 2
+	})
+	assert.Equal(t, []string{"ban", "banana"}, got)
+}
+
+func TestDeletePrefix(t *testing.T) {
+	tr := New[string]()
+	for _, k := range []string{"a", "ab", "abc", "abd", "b", "bc"} {
+		tr.Insert(k, k)
+	}
+	assert.Equal(t, 3, tr.DeletePrefix("ab"))
+	assert.Equal(t, 0, tr.DeletePrefix("x"))
+	assert.Equal(t, 0, tr.DeletePrefix("abz"))
+	tr.Publish()
+	assert.Equal(t, []string{"a", "b", "bc"}, keys(tr, ""))
+
+	assert.Equal(t, 3, tr.DeletePrefix(""))
+	tr.Publish()
+	assert.Equal(t, 0, tr.Len())
+	assert.Nil(t, keys(tr, ""))
+}
+
+func TestRandomAgainstMap(t *testing.T) {
+	tr := New[int]()
+	ref := make(map[string]int)
+	randKey := func() string {
+		b := make([]byte, rand.Intn(6))
+		for i := range b {
+			b[i] = "abc"[rand.Intn(3)]
+		}
+		return string(b)
+	}
+	for i := 0; i < 5000; i++ {
+		k := randKey()
+		switch rand.Intn(10) {
+		case 0:
+			removed := 0
+			for rk := range ref {
+				if strings.HasPrefix(rk, k) {
+					delete(ref, rk)
+					removed++
+				}
+			}
+			assert.Equal(t, removed, tr.DeletePrefix(k))
+		case 1, 2, 3:
+			_, ok := ref[k]
+			delete(ref, k)
+			assert.Equal(t, ok, tr.Delete(k))
+		default:
+			_, ok := ref[k]
+			ref[k] = i
+			assert.Equal(t, !ok, tr.Insert(k, i))
+		}
+		if i%50 == 0 {
+			tr.Publish()
+		}
+	}
+	var want []string
+	for k := range ref {
+		want = append(want, k)
+	}
+	sort.Strings(want)
+
+	// Check both sides.
+	for i := 0; i < 2; i++ {
+		tr.Publish()
+		assert.Equal(t, len(ref), tr.Len())
+		assert.Equal(t, want, keys(tr, ""))
+		for k, v := range ref {
+			got, ok := tr.Lookup(k)
+			assert.True(t, ok)
+			assert.Equal(t, v, got)
+		}
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	tr := New[int]()
+	tr.Insert("/", 0)
+	tr.Publish()
+	lrtest.ConcurrentReaders(500, func(int) {
+		// "/" is never deleted, so there is always a match.
+		_, _, ok := tr.LongestPrefixMatch("/a/b/c/d")
+		assert.True(t, ok)
+	}, func(i int) {
+		tr.Insert("/a/b", i)
+		tr.Publish()
+		tr.DeletePrefix("/a")
+		tr.Publish()
+	})
+}